@@ -0,0 +1,1003 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrBacktrackLimit is returned when BacktrackEngine gives up matching a text
+// after exhausting its step budget.
+var ErrBacktrackLimit = errors.New("backtracking step budget exhausted")
+
+// DefaultBacktrackSteps is the step budget of a BacktrackEngine with no
+// MaxSteps.
+const DefaultBacktrackSteps = 1000000
+
+// BacktrackEngine is a backtracking Engine supporting the Oniguruma constructs
+// RE2 rejects: lookahead, lookbehind, atomic groups, possessive quantifiers and
+// backreferences. Its matching time may grow exponentially with the size of
+// the text, so every match is bounded by a step budget, ErrBacktrackLimit
+// being returned by the parse methods when it is exhausted.
+type BacktrackEngine struct {
+	// MaxSteps bounds the number of steps of a single match,
+	// DefaultBacktrackSteps when zero.
+	MaxSteps int
+}
+
+// Compile parses expression, which uses the RE2 syntax extended with the
+// constructs listed by Supports.
+func (e BacktrackEngine) Compile(expression string) (Regexp, error) {
+	p := &btParser{src: expression, names: []string{""}}
+	prog, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing regexp: %v: `%s`", err, expression)
+	}
+
+	maxSteps := e.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultBacktrackSteps
+	}
+	return &btRegexp{
+		expr:     expression,
+		prog:     prog,
+		names:    p.names,
+		anchored: prog.anchored(),
+		maxSteps: maxSteps,
+	}, nil
+}
+
+// Supports reports whether the construct of a CompatError is supported.
+func (BacktrackEngine) Supports(construct string) bool {
+	switch construct {
+	case "lookahead", "lookbehind", "atomic group", "possessive quantifier", "backreference":
+		return true
+	}
+	return false
+}
+
+type btOp int
+
+const (
+	btEmpty btOp = iota
+	btLiteral
+	btCharClass
+	btAnyChar
+	btAnyCharNotNL
+	btBeginText
+	btEndText
+	btEndTextOptNL
+	btBeginLine
+	btEndLine
+	btWordBoundary
+	btNoWordBoundary
+	btCapture
+	btConcat
+	btAlternate
+	btRepeat
+	btLookahead
+	btLookbehind
+	btAtomic
+	btBackref
+)
+
+// btNode is a node of a parsed expression.
+type btNode struct {
+	op     btOp
+	r      rune     // btLiteral
+	class  *btClass // btCharClass
+	fold   bool     // case insensitive btLiteral, btCharClass and btBackref
+	subs   []*btNode
+	sub    *btNode
+	min    int  // btRepeat
+	max    int  // btRepeat, -1 when unbounded
+	greedy bool // btRepeat
+	negate bool // btLookahead and btLookbehind
+	cap    int  // btCapture and btBackref
+	ref    string
+}
+
+// anchored reports whether n only matches at the beginning of the text.
+func (n *btNode) anchored() bool {
+	switch n.op {
+	case btBeginText:
+		return true
+	case btConcat:
+		return len(n.subs) > 0 && n.subs[0].anchored()
+	case btCapture, btAtomic:
+		return n.sub.anchored()
+	case btAlternate:
+		for _, sub := range n.subs {
+			if !sub.anchored() {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// width returns the minimum and maximum number of runes n matches, max being
+// -1 when unbounded or unknown.
+func (n *btNode) width() (min, max int) {
+	switch n.op {
+	case btLiteral, btCharClass, btAnyChar, btAnyCharNotNL:
+		return 1, 1
+	case btCapture, btAtomic:
+		return n.sub.width()
+	case btConcat:
+		for _, sub := range n.subs {
+			lo, hi := sub.width()
+			min += lo
+			if max >= 0 {
+				if hi < 0 {
+					max = -1
+				} else {
+					max += hi
+				}
+			}
+		}
+		return min, max
+	case btAlternate:
+		for i, sub := range n.subs {
+			lo, hi := sub.width()
+			if i == 0 || lo < min {
+				min = lo
+			}
+			if i == 0 || max >= 0 && (hi < 0 || hi > max) {
+				max = hi
+			}
+		}
+		return min, max
+	case btRepeat:
+		lo, hi := n.sub.width()
+		if n.max < 0 || hi < 0 {
+			return lo * n.min, -1
+		}
+		return lo * n.min, hi * n.max
+	case btBackref:
+		return 0, -1
+	}
+	return 0, 0
+}
+
+// btClass is a character class.
+type btClass struct {
+	negate bool
+	ranges []rune // pairs of inclusive bounds
+	tables []*unicode.RangeTable
+	subs   []*btClass // nested classes, such as \D in [\D_]
+}
+
+func (c *btClass) matches(r rune, fold bool) bool {
+	if c.contains(r) {
+		return true
+	}
+	if fold {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if c.contains(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *btClass) contains(r rune) bool {
+	in := false
+	for i := 0; i+1 < len(c.ranges) && !in; i += 2 {
+		in = c.ranges[i] <= r && r <= c.ranges[i+1]
+	}
+	for i := 0; i < len(c.tables) && !in; i++ {
+		in = unicode.Is(c.tables[i], r)
+	}
+	for i := 0; i < len(c.subs) && !in; i++ {
+		in = c.subs[i].contains(r)
+	}
+	return in != c.negate
+}
+
+var (
+	btDigit = []rune{'0', '9'}
+	btWord  = []rune{'0', '9', 'A', 'Z', '_', '_', 'a', 'z'}
+	btSpace = []rune{'\t', '\n', '\f', '\r', ' ', ' '}
+
+	btPosix = map[string][]rune{
+		"alnum":  {'0', '9', 'A', 'Z', 'a', 'z'},
+		"alpha":  {'A', 'Z', 'a', 'z'},
+		"ascii":  {0, 0x7f},
+		"blank":  {'\t', '\t', ' ', ' '},
+		"cntrl":  {0, 0x1f, 0x7f, 0x7f},
+		"digit":  btDigit,
+		"graph":  {'!', '~'},
+		"lower":  {'a', 'z'},
+		"print":  {' ', '~'},
+		"punct":  {'!', '/', ':', '@', '[', '`', '{', '~'},
+		"space":  {'\t', '\r', ' ', ' '},
+		"upper":  {'A', 'Z'},
+		"word":   btWord,
+		"xdigit": {'0', '9', 'A', 'F', 'a', 'f'},
+	}
+)
+
+// btFlags are the flags of a group, as set by (?imsU).
+type btFlags struct {
+	fold      bool // i
+	multiline bool // m
+	dotNL     bool // s
+	ungreedy  bool // U
+}
+
+// btParser parses an expression into a tree of btNode.
+type btParser struct {
+	src   string
+	pos   int
+	names []string // names of the captures, names[0] being the whole match
+	refs  []*btNode
+}
+
+func (p *btParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at offset %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *btParser) parse() (*btNode, error) {
+	n, err := p.parseAlternate(&btFlags{})
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected )")
+	}
+
+	// named backreferences may precede the group they refer to
+	for _, ref := range p.refs {
+		if ref.ref == "" {
+			if ref.cap >= len(p.names) {
+				return nil, fmt.Errorf("invalid backreference \\%d", ref.cap)
+			}
+			continue
+		}
+		ref.cap = -1
+		for i, name := range p.names {
+			if name == ref.ref {
+				ref.cap = i
+				break
+			}
+		}
+		if ref.cap < 0 {
+			return nil, fmt.Errorf("invalid backreference \\k<%s>", ref.ref)
+		}
+	}
+	return n, nil
+}
+
+func (p *btParser) more() bool {
+	return p.pos < len(p.src)
+}
+
+func (p *btParser) peek(prefix string) bool {
+	return strings.HasPrefix(p.src[p.pos:], prefix)
+}
+
+func (p *btParser) parseAlternate(flags *btFlags) (*btNode, error) {
+	var alts []*btNode
+	for {
+		n, err := p.parseConcat(flags)
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, n)
+		if !p.peek("|") {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return &btNode{op: btAlternate, subs: alts}, nil
+}
+
+func (p *btParser) parseConcat(flags *btFlags) (*btNode, error) {
+	var subs []*btNode
+	for p.more() && !p.peek("|") && !p.peek(")") {
+		n, err := p.parseAtom(flags)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			// flags group such as (?i)
+			continue
+		}
+		if n, err = p.parseRepeat(n, flags); err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+	switch len(subs) {
+	case 0:
+		return &btNode{op: btEmpty}, nil
+	case 1:
+		return subs[0], nil
+	}
+	return &btNode{op: btConcat, subs: subs}, nil
+}
+
+func (p *btParser) parseRepeat(n *btNode, flags *btFlags) (*btNode, error) {
+	for p.more() {
+		min, max := 0, 0
+		switch c := p.src[p.pos]; {
+		case c == '*':
+			min, max = 0, -1
+			p.pos++
+		case c == '+':
+			min, max = 1, -1
+			p.pos++
+		case c == '?':
+			min, max = 0, 1
+			p.pos++
+		case c == '{' && repetition.MatchString(p.src[p.pos:]):
+			s := repetition.FindString(p.src[p.pos:])
+			bounds := strings.SplitN(s[1:len(s)-1], ",", 2)
+			min, _ = strconv.Atoi(bounds[0])
+			max = min
+			if len(bounds) == 2 {
+				max = -1
+				if bounds[1] != "" {
+					max, _ = strconv.Atoi(bounds[1])
+				}
+			}
+			if min > 1000 || max > 1000 || max >= 0 && max < min {
+				return nil, p.errorf("invalid repeat count %s", s)
+			}
+			p.pos += len(s)
+		default:
+			return n, nil
+		}
+
+		// as in Ruby, a + following {n,m} repeats the repetition
+		braces := p.src[p.pos-1] == '}'
+		greedy, possessive := !flags.ungreedy, false
+		switch {
+		case p.peek("?"):
+			greedy = !greedy
+			p.pos++
+		case p.peek("+") && !braces:
+			possessive = true
+			p.pos++
+		}
+		n = &btNode{op: btRepeat, sub: n, min: min, max: max, greedy: greedy}
+		if possessive {
+			n = &btNode{op: btAtomic, sub: n}
+		}
+	}
+	return n, nil
+}
+
+func (p *btParser) parseAtom(flags *btFlags) (*btNode, error) {
+	switch c := p.src[p.pos]; c {
+	case '(':
+		return p.parseGroup(flags)
+	case '[':
+		class, err := p.parseClass()
+		if err != nil {
+			return nil, err
+		}
+		return &btNode{op: btCharClass, class: class, fold: flags.fold}, nil
+	case '.':
+		p.pos++
+		if flags.dotNL {
+			return &btNode{op: btAnyChar}, nil
+		}
+		return &btNode{op: btAnyCharNotNL}, nil
+	case '^':
+		p.pos++
+		if flags.multiline {
+			return &btNode{op: btBeginLine}, nil
+		}
+		return &btNode{op: btBeginText}, nil
+	case '$':
+		p.pos++
+		if flags.multiline {
+			return &btNode{op: btEndLine}, nil
+		}
+		return &btNode{op: btEndText}, nil
+	case '*', '+', '?':
+		return nil, p.errorf("missing argument to repetition operator %c", c)
+	case '\\':
+		return p.parseEscape(flags)
+	}
+
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return &btNode{op: btLiteral, r: r, fold: flags.fold}, nil
+}
+
+func (p *btParser) parseGroup(flags *btFlags) (*btNode, error) {
+	start := p.pos
+	inner := *flags
+	var n *btNode
+
+	switch {
+	case p.peek("(?P<") || p.peek("(?<") && !p.peek("(?<=") && !p.peek("(?<!"):
+		p.pos += strings.IndexByte(p.src[p.pos:], '<') + 1
+		end := strings.IndexByte(p.src[p.pos:], '>')
+		if end < 0 {
+			return nil, p.errorf("invalid named capture")
+		}
+		name := p.src[p.pos : p.pos+end]
+		for _, r := range name {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				return nil, p.errorf("invalid named capture %q", name)
+			}
+		}
+		p.pos += end + 1
+		n = &btNode{op: btCapture, cap: len(p.names)}
+		p.names = append(p.names, name)
+	case p.peek("(?="), p.peek("(?!"):
+		n = &btNode{op: btLookahead, negate: p.src[p.pos+2] == '!'}
+		p.pos += 3
+	case p.peek("(?<="), p.peek("(?<!"):
+		n = &btNode{op: btLookbehind, negate: p.src[p.pos+3] == '!'}
+		p.pos += 4
+	case p.peek("(?>"):
+		n = &btNode{op: btAtomic}
+		p.pos += 3
+	case p.peek("(?"):
+		// flags, and non capturing group
+		p.pos += 2
+		set := true
+		for {
+			if !p.more() {
+				return nil, p.errorf("missing closing )")
+			}
+			c := p.src[p.pos]
+			p.pos++
+			switch c {
+			case 'i':
+				inner.fold = set
+			case 'm':
+				inner.multiline = set
+			case 's':
+				inner.dotNL = set
+			case 'U':
+				inner.ungreedy = set
+			case '-':
+				set = false
+			case ')':
+				// the flags apply to the rest of the current group
+				*flags = inner
+				return nil, nil
+			case ':':
+				sub, err := p.parseAlternate(&inner)
+				if err != nil {
+					return nil, err
+				}
+				if !p.peek(")") {
+					return nil, p.errorf("missing closing )")
+				}
+				p.pos++
+				return sub, nil
+			default:
+				p.pos = start
+				return nil, p.errorf("invalid or unsupported group")
+			}
+		}
+	default:
+		p.pos++
+		n = &btNode{op: btCapture, cap: len(p.names)}
+		p.names = append(p.names, "")
+	}
+
+	sub, err := p.parseAlternate(&inner)
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek(")") {
+		return nil, p.errorf("missing closing )")
+	}
+	p.pos++
+	n.sub = sub
+	return n, nil
+}
+
+func (p *btParser) parseEscape(flags *btFlags) (*btNode, error) {
+	if p.pos+1 >= len(p.src) {
+		return nil, p.errorf("trailing backslash at end of expression")
+	}
+	c := p.src[p.pos+1]
+	switch c {
+	case 'A':
+		p.pos += 2
+		return &btNode{op: btBeginText}, nil
+	case 'z':
+		p.pos += 2
+		return &btNode{op: btEndText}, nil
+	case 'Z':
+		p.pos += 2
+		return &btNode{op: btEndTextOptNL}, nil
+	case 'b':
+		p.pos += 2
+		return &btNode{op: btWordBoundary}, nil
+	case 'B':
+		p.pos += 2
+		return &btNode{op: btNoWordBoundary}, nil
+	case 'k':
+		if !p.peek(`\k<`) {
+			return nil, p.errorf("invalid escape sequence \\k")
+		}
+		end := strings.IndexByte(p.src[p.pos:], '>')
+		if end < 0 {
+			return nil, p.errorf("invalid backreference")
+		}
+		n := &btNode{op: btBackref, ref: p.src[p.pos+3 : p.pos+end], fold: flags.fold}
+		p.pos += end + 1
+		p.refs = append(p.refs, n)
+		return n, nil
+	}
+	if c >= '1' && c <= '9' {
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] >= '0' && p.src[end] <= '9' {
+			end++
+		}
+		index, _ := strconv.Atoi(p.src[p.pos+1 : end])
+		p.pos = end
+		n := &btNode{op: btBackref, cap: index, fold: flags.fold}
+		p.refs = append(p.refs, n)
+		return n, nil
+	}
+
+	class, r, err := p.parseClassEscape()
+	if err != nil {
+		return nil, err
+	}
+	if class != nil {
+		return &btNode{op: btCharClass, class: class, fold: flags.fold}, nil
+	}
+	return &btNode{op: btLiteral, r: r, fold: flags.fold}, nil
+}
+
+// parseClassEscape parses an escape sequence valid both in and out of
+// character classes, returning either a class or a rune.
+func (p *btParser) parseClassEscape() (*btClass, rune, error) {
+	c := p.src[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'd', 'D':
+		return &btClass{ranges: btDigit, negate: c == 'D'}, 0, nil
+	case 'w', 'W':
+		return &btClass{ranges: btWord, negate: c == 'W'}, 0, nil
+	case 's', 'S':
+		return &btClass{ranges: btSpace, negate: c == 'S'}, 0, nil
+	case 'p', 'P':
+		name := ""
+		switch {
+		case p.peek("{"):
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return nil, 0, p.errorf("invalid character class range")
+			}
+			name = p.src[p.pos+1 : p.pos+end]
+			p.pos += end + 1
+		case p.more():
+			name = p.src[p.pos : p.pos+1]
+			p.pos++
+		}
+		negate := c == 'P'
+		if strings.HasPrefix(name, "^") {
+			name, negate = name[1:], !negate
+		}
+		if name == "Any" {
+			return &btClass{ranges: []rune{0, unicode.MaxRune}, negate: negate}, 0, nil
+		}
+		table, ok := unicode.Categories[name]
+		if !ok {
+			table, ok = unicode.Scripts[name]
+		}
+		if !ok {
+			return nil, 0, p.errorf("invalid character class range \\%c{%s}", c, name)
+		}
+		return &btClass{tables: []*unicode.RangeTable{table}, negate: negate}, 0, nil
+	case 'n':
+		return nil, '\n', nil
+	case 't':
+		return nil, '\t', nil
+	case 'r':
+		return nil, '\r', nil
+	case 'f':
+		return nil, '\f', nil
+	case 'v':
+		return nil, '\v', nil
+	case 'a':
+		return nil, '\a', nil
+	case 'e':
+		return nil, 0x1b, nil
+	case '0':
+		end := p.pos
+		for end < len(p.src) && end < p.pos+2 && p.src[end] >= '0' && p.src[end] <= '7' {
+			end++
+		}
+		r, _ := strconv.ParseInt("0"+p.src[p.pos:end], 8, 32)
+		p.pos = end
+		return nil, rune(r), nil
+	case 'x':
+		var hex string
+		if p.peek("{") {
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return nil, 0, p.errorf("invalid escape sequence")
+			}
+			hex = p.src[p.pos+1 : p.pos+end]
+			p.pos += end + 1
+		} else if p.pos+2 <= len(p.src) {
+			hex = p.src[p.pos : p.pos+2]
+			p.pos += 2
+		}
+		r, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || r > unicode.MaxRune {
+			return nil, 0, p.errorf("invalid escape sequence \\x%s", hex)
+		}
+		return nil, rune(r), nil
+	}
+
+	r, size := utf8.DecodeRuneInString(p.src[p.pos-1:])
+	if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		p.pos--
+		return nil, 0, p.errorf("invalid escape sequence \\%c", r)
+	}
+	p.pos += size - 1
+	return nil, r, nil
+}
+
+func (p *btParser) parseClass() (*btClass, error) {
+	start := p.pos
+	p.pos++
+	class := &btClass{}
+	if p.peek("^") {
+		class.negate = true
+		p.pos++
+	}
+
+	first := true
+	for {
+		if !p.more() {
+			p.pos = start
+			return nil, p.errorf("missing closing ]")
+		}
+		if p.peek("]") && !first {
+			p.pos++
+			return class, nil
+		}
+		first = false
+
+		if p.peek("[:") {
+			end := strings.Index(p.src[p.pos:], ":]")
+			if end > 0 {
+				name := p.src[p.pos+2 : p.pos+end]
+				negate := strings.HasPrefix(name, "^")
+				ranges, ok := btPosix[strings.TrimPrefix(name, "^")]
+				if !ok {
+					return nil, p.errorf("invalid character class range [:%s:]", name)
+				}
+				class.subs = append(class.subs, &btClass{ranges: ranges, negate: negate})
+				p.pos += end + 2
+				continue
+			}
+		}
+
+		lo, err := p.parseClassRune(class)
+		if err != nil {
+			return nil, err
+		}
+		if lo < 0 {
+			// a nested class such as \d
+			continue
+		}
+		hi := lo
+		if p.peek("-") && p.pos+1 < len(p.src) && p.src[p.pos+1] != ']' {
+			p.pos++
+			if hi, err = p.parseClassRune(class); err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, p.errorf("invalid character class range")
+			}
+		}
+		class.ranges = append(class.ranges, lo, hi)
+	}
+}
+
+// parseClassRune parses a rune of a character class. Escapes denoting a class
+// are added to class and reported with a negative rune.
+func (p *btParser) parseClassRune(class *btClass) (rune, error) {
+	if p.peek(`\`) && p.pos+1 < len(p.src) {
+		sub, r, err := p.parseClassEscape()
+		if err != nil {
+			return 0, err
+		}
+		if sub != nil {
+			class.subs = append(class.subs, sub)
+			return -1, nil
+		}
+		return r, nil
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return r, nil
+}
+
+// btRegexp is an expression compiled by BacktrackEngine.
+type btRegexp struct {
+	expr     string
+	prog     *btNode
+	names    []string
+	anchored bool
+	maxSteps int
+}
+
+func (re *btRegexp) String() string {
+	return re.expr
+}
+
+func (re *btRegexp) SubexpNames() []string {
+	return re.names
+}
+
+func (re *btRegexp) MatchString(s string) bool {
+	loc, _ := re.FindStringSubmatchIndexErr(s)
+	return loc != nil
+}
+
+func (re *btRegexp) FindStringSubmatchIndex(s string) []int {
+	loc, _ := re.FindStringSubmatchIndexErr(s)
+	return loc
+}
+
+// FindStringSubmatchIndexErr is FindStringSubmatchIndex, reporting
+// ErrBacktrackLimit when the step budget is exhausted.
+func (re *btRegexp) FindStringSubmatchIndexErr(s string) ([]int, error) {
+	m := &btMachine{text: s, caps: make([]int, 2*len(re.names)), maxSteps: re.maxSteps}
+	for start := 0; start <= len(s); {
+		for i := range m.caps {
+			m.caps[i] = -1
+		}
+		found := m.match(re.prog, start, func(end int) bool {
+			m.caps[0], m.caps[1] = start, end
+			return true
+		})
+		if m.err != nil {
+			return nil, m.err
+		}
+		if found {
+			return m.caps, nil
+		}
+		if re.anchored || start == len(s) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		start += size
+	}
+	return nil, nil
+}
+
+// btMachine holds the state of a match.
+type btMachine struct {
+	text     string
+	caps     []int
+	steps    int
+	maxSteps int
+	err      error
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+func (m *btMachine) atWordBoundary(i int) bool {
+	before := i > 0 && isWordByte(m.text[i-1])
+	after := i < len(m.text) && isWordByte(m.text[i])
+	return before != after
+}
+
+// match reports whether n matches the text at offset i, followed by a match of
+// the continuation k.
+func (m *btMachine) match(n *btNode, i int, k func(int) bool) bool {
+	if m.err != nil {
+		return false
+	}
+	if m.steps++; m.steps > m.maxSteps {
+		m.err = ErrBacktrackLimit
+		return false
+	}
+
+	text := m.text
+	switch n.op {
+	case btEmpty:
+		return k(i)
+
+	case btLiteral:
+		if i >= len(text) {
+			return false
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != n.r && !(n.fold && equalFold(r, n.r)) {
+			return false
+		}
+		return k(i + size)
+
+	case btCharClass, btAnyChar, btAnyCharNotNL:
+		if i >= len(text) {
+			return false
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case n.op == btAnyCharNotNL && r == '\n':
+			return false
+		case n.op == btCharClass && !n.class.matches(r, n.fold):
+			return false
+		}
+		return k(i + size)
+
+	case btBeginText:
+		return i == 0 && k(i)
+	case btEndText:
+		return i == len(text) && k(i)
+	case btEndTextOptNL:
+		return (i == len(text) || i == len(text)-1 && text[i] == '\n') && k(i)
+	case btBeginLine:
+		return (i == 0 || text[i-1] == '\n') && k(i)
+	case btEndLine:
+		return (i == len(text) || text[i] == '\n') && k(i)
+	case btWordBoundary:
+		return m.atWordBoundary(i) && k(i)
+	case btNoWordBoundary:
+		return !m.atWordBoundary(i) && k(i)
+
+	case btConcat:
+		return m.concat(n.subs, i, k)
+
+	case btAlternate:
+		for _, sub := range n.subs {
+			if m.match(sub, i, k) {
+				return true
+			}
+		}
+		return false
+
+	case btCapture:
+		c := 2 * n.cap
+		return m.match(n.sub, i, func(j int) bool {
+			start, end := m.caps[c], m.caps[c+1]
+			m.caps[c], m.caps[c+1] = i, j
+			if k(j) {
+				return true
+			}
+			m.caps[c], m.caps[c+1] = start, end
+			return false
+		})
+
+	case btRepeat:
+		return m.repeat(n, i, 0, k)
+
+	case btLookahead, btLookbehind:
+		saved := append([]int(nil), m.caps...)
+		var found bool
+		if n.op == btLookahead {
+			found = m.match(n.sub, i, func(int) bool { return true })
+		} else {
+			found = m.lookbehind(n.sub, i)
+		}
+		if found == n.negate {
+			copy(m.caps, saved)
+			return false
+		}
+		if n.negate {
+			copy(m.caps, saved)
+		}
+		if k(i) {
+			return true
+		}
+		copy(m.caps, saved)
+		return false
+
+	case btAtomic:
+		saved := append([]int(nil), m.caps...)
+		end := -1
+		if !m.match(n.sub, i, func(j int) bool { end = j; return true }) {
+			return false
+		}
+		if k(end) {
+			return true
+		}
+		copy(m.caps, saved)
+		return false
+
+	case btBackref:
+		start, end := m.caps[2*n.cap], m.caps[2*n.cap+1]
+		if start < 0 {
+			return false
+		}
+		ref := text[start:end]
+		if !n.fold {
+			return strings.HasPrefix(text[i:], ref) && k(i+len(ref))
+		}
+		j := i
+		for _, r := range ref {
+			if j >= len(text) {
+				return false
+			}
+			c, size := utf8.DecodeRuneInString(text[j:])
+			if !equalFold(c, r) {
+				return false
+			}
+			j += size
+		}
+		return k(j)
+	}
+
+	return false
+}
+
+func (m *btMachine) concat(subs []*btNode, i int, k func(int) bool) bool {
+	if len(subs) == 0 {
+		return k(i)
+	}
+	return m.match(subs[0], i, func(j int) bool {
+		return m.concat(subs[1:], j, k)
+	})
+}
+
+func (m *btMachine) repeat(n *btNode, i, count int, k func(int) bool) bool {
+	more := func() bool {
+		if n.max >= 0 && count >= n.max {
+			return false
+		}
+		return m.match(n.sub, i, func(j int) bool {
+			// an empty iteration cannot make progress
+			if j == i && count >= n.min {
+				return false
+			}
+			return m.repeat(n, j, count+1, k)
+		})
+	}
+
+	switch {
+	case count < n.min:
+		return more()
+	case n.greedy:
+		return more() || m.err == nil && k(i)
+	default:
+		return k(i) || more()
+	}
+}
+
+// lookbehind reports whether sub matches a piece of the text ending at i.
+func (m *btMachine) lookbehind(sub *btNode, i int) bool {
+	_, max := sub.width()
+	for j, runes := i, 0; j >= 0; runes++ {
+		if m.match(sub, j, func(end int) bool { return end == i }) {
+			return true
+		}
+		if j == 0 || max >= 0 && runes >= max || m.err != nil {
+			return false
+		}
+		_, size := utf8.DecodeLastRuneInString(m.text[:j])
+		j -= size
+	}
+	return false
+}
+
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBacktrackMatchesRE2(t *testing.T) {
+	tests := []struct {
+		expression string
+		texts      []string
+	}{
+		{`a+b*`, []string{"aab", "b", "xaaab"}},
+		{`(a|ab)(c|bcd)(d*)`, []string{"abcd", "abcdd"}},
+		{`(?P<first>\w+)\s+(?P<last>\w+)`, []string{"john  doe", "   x y z"}},
+		{`^\d{2,3}$`, []string{"12", "1234", "123"}},
+		{`(?i)héllo [[:alpha:]]+`, []string{"HÉLLO World", "hello 42"}},
+		{`(?s)a.b`, []string{"a\nb"}},
+		{`a.b`, []string{"a\nb", "axb"}},
+		{`(?m)^b$`, []string{"a\nb\nc"}},
+		{`\bfoo\b`, []string{"a foo b", "afoob"}},
+		{`[^a-c\d]+`, []string{"abc123def"}},
+		{`x*?y`, []string{"xxy"}},
+		{`(a*)*b`, []string{"aaab", "c"}},
+		{`(a?){3}`, []string{"aa"}},
+		{`\x41\x{42}[\]-]`, []string{"AB]", "AB-"}},
+		{`\pL+\PL`, []string{"été!"}},
+		{`(?:%{X})?(\.|$)`, []string{"%{X}.", "nothing"}},
+		{`((?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4})(%.+)?`, []string{"fe80:0:0:0:0:0:0:1%eth0"}},
+	}
+
+	for _, test := range tests {
+		re2 := regexp.MustCompile(test.expression)
+		bt, err := BacktrackEngine{}.Compile(test.expression)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expression, err)
+		}
+		if fmt.Sprint(bt.SubexpNames()) != fmt.Sprint(re2.SubexpNames()) {
+			t.Errorf("%s: subexp names should be %q, have %q", test.expression, re2.SubexpNames(), bt.SubexpNames())
+		}
+		for _, text := range test.texts {
+			expected := re2.FindStringSubmatchIndex(text)
+			if loc := bt.FindStringSubmatchIndex(text); fmt.Sprint(loc) != fmt.Sprint(expected) {
+				t.Errorf("%s on %q should match %v, have %v", test.expression, text, expected, loc)
+			}
+		}
+	}
+}
+
+func TestBacktrackExtendedConstructs(t *testing.T) {
+	tests := []struct {
+		expression string
+		text       string
+		expected   string // whole match, "-" when there is none
+	}{
+		{`(?<={ ).*(?= })`, "{ a: 1 }", "a: 1"},
+		{`(?<!\$)\b\d+`, "$12 34", "34"},
+		{`foo(?!bar)\w+`, "foobar foobaz", "foobaz"},
+		{`(?<![0-9])\d{2}(?![0-9])`, "123 45 678", "45"},
+		{`(\w)\1`, "abccd", "cc"},
+		{`(?P<q>['"]).*?\k<q>`, `x "it's" y`, `"it's"`},
+		{`(?i)(a)\1`, "aA", "aA"},
+		{`(?>a+)b`, "aaab", "aaab"},
+		{`(?>a+)ab`, "aaab", "-"},
+		{`a++b`, "aaab", "aaab"},
+		{`a++ab`, "aaab", "-"},
+		{`\d{2}+\d`, "12345", "12345"},
+	}
+
+	for _, test := range tests {
+		re, err := BacktrackEngine{}.Compile(test.expression)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expression, err)
+		}
+		loc := re.FindStringSubmatchIndex(test.text)
+		match := "-"
+		if loc != nil {
+			match = test.text[loc[0]:loc[1]]
+		}
+		if match != test.expected {
+			t.Errorf("%s on %q should match %q, have %q", test.expression, test.text, test.expected, match)
+		}
+	}
+}
+
+func TestBacktrackCompileErrors(t *testing.T) {
+	for _, expression := range []string{`(a`, `a)`, `*a`, `[a`, `\q`, `(?Z)`, `\2(a)`, `\k<nope>`, `a{5,2}`, `\p{Nope}`} {
+		if _, err := (BacktrackEngine{}).Compile(expression); err == nil {
+			t.Errorf("%s should not compile", expression)
+		}
+	}
+}
+
+func TestBacktrackStepBudget(t *testing.T) {
+	re, _ := BacktrackEngine{MaxSteps: 10000}.Compile(`(a|aa)*c`)
+	if _, err := re.(fallibleRegexp).FindStringSubmatchIndexErr(strings.Repeat("a", 40)); !errors.Is(err, ErrBacktrackLimit) {
+		t.Fatalf("exponential backtracking should exhaust the step budget, have %v", err)
+	}
+
+	g, _ := NewWithConfig(&Config{Engine: BacktrackEngine{MaxSteps: 10000}})
+	if _, err := g.Parse(`(a|aa)*c`, strings.Repeat("a", 40)); !errors.Is(err, ErrBacktrackLimit) {
+		t.Fatalf("Parse should report the exhausted step budget, have %v", err)
+	}
+	if _, err := g.Match(`(a|aa)*c`, strings.Repeat("a", 40)); !errors.Is(err, ErrBacktrackLimit) {
+		t.Fatalf("Match should report the exhausted step budget, have %v", err)
+	}
+}
+
+func TestBacktrackEngineWithPatterns(t *testing.T) {
+	g, err := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		PatternsDir:       []string{"./patterns"},
+		Engine:            BacktrackEngine{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captures, err := g.Parse("%{MONGO_SLOWQUERY}", `query test.users query: { name: "bob" } ntoreturn:0 ntoskip:0 nscanned:12 keyUpdates:0 locks(micros) r:125 nreturned:1 reslen:92 15ms`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["query"] != `{ name: "bob" }` || captures["duration"] != "15" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	captures, err = g.Parse("%{HAPROXYTIME}", "at 09:32:07.123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["haproxy_hour"] != "09" || captures["haproxy_second"] != "07.123" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	captures, err = g.Parse(`(?<word>\w+) \k<word>`, "hello hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["word"] != "hello" {
+		t.Fatalf("word should be 'hello' have '%s'", captures["word"])
+	}
+
+	// results are the same as with RE2
+	re2, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+	expected, _ := re2.Parse("%{COMMONAPACHELOG}", text)
+	captures, _ = g.Parse("%{COMMONAPACHELOG}", text)
+	if fmt.Sprint(captures) != fmt.Sprint(expected) {
+		t.Fatalf("backtracking engine should capture %v, have %v", expected, captures)
+	}
+}
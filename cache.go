@@ -0,0 +1,102 @@
+package grok
+
+import (
+	"container/list"
+	"sync/atomic"
+)
+
+// CacheStats reports the activity of the compiled pattern cache of a Grok
+// object.
+type CacheStats struct {
+	Hits      uint64 // lookups served from the cache
+	Misses    uint64 // lookups that required a compilation
+	Evictions uint64 // entries dropped to honour Config.MaxCompiledPatterns
+	Size      int    // number of compiled patterns currently cached
+}
+
+// patternCache stores compiled expressions keyed on the grok expression. When
+// max is greater than zero it keeps at most max entries and evicts the least
+// recently used one. It is not safe for concurrent use, Grok guards it with
+// compiledGuard.
+type patternCache struct {
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+type cacheEntry struct {
+	key string
+	gr  *gRegexp
+}
+
+func newPatternCache(max int) *patternCache {
+	return &patternCache{
+		max:   max,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// bounded reports whether the cache evicts entries.
+func (c *patternCache) bounded() bool {
+	return c.max > 0
+}
+
+// get returns the compiled expression stored for key. The recency list is only
+// updated when the cache is bounded, so an unbounded cache can be read while
+// holding a read lock.
+func (c *patternCache) get(key string) (*gRegexp, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	if c.bounded() {
+		c.ll.MoveToFront(e)
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return e.Value.(*cacheEntry).gr, true
+}
+
+// add stores gr under key and returns it, or the cached expression when key
+// is already cached. The least recently used entries are evicted to make room
+// for gr.
+func (c *patternCache) add(key string, gr *gRegexp) *gRegexp {
+	if e, ok := c.items[key]; ok {
+		return e.Value.(*cacheEntry).gr
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, gr: gr})
+	for c.bounded() && c.ll.Len() > c.max {
+		e := c.ll.Back()
+		entry := c.ll.Remove(e).(*cacheEntry)
+		delete(c.items, entry.key)
+		c.evictions++
+	}
+	return gr
+}
+
+func (c *patternCache) len() int {
+	return c.ll.Len()
+}
+
+// boundedCache reports whether the compiled cache evicts entries. Unlike
+// compiledPatterns.bounded, it may be called without holding compiledGuard.
+func (g *Grok) boundedCache() bool {
+	return g.config.MaxCompiledPatterns > 0
+}
+
+// CacheStats returns a snapshot of the compiled pattern cache counters.
+func (g *Grok) CacheStats() CacheStats {
+	g.compiledGuard.RLock()
+	defer g.compiledGuard.RUnlock()
+
+	c := g.compiledPatterns
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: c.evictions,
+		Size:      c.len(),
+	}
+}
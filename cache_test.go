@@ -0,0 +1,80 @@
+package grok
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCacheStats(t *testing.T) {
+	g, _ := New()
+	g.Parse("%{WORD:verb}", "GET")
+	g.Parse("%{WORD:verb}", "POST")
+	g.Parse("%{INT:code}", "404")
+
+	stats := g.CacheStats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Size != 2 || stats.Evictions != 0 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+}
+
+func TestMaxCompiledPatterns(t *testing.T) {
+	g, _ := NewWithConfig(&Config{MaxCompiledPatterns: 2})
+	for i := 0; i < 5; i++ {
+		if _, err := g.Parse(fmt.Sprintf("%%{INT:field%d}", i), "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := g.CacheStats()
+	if stats.Size != 2 {
+		t.Fatalf("cache should hold 2 patterns, have %d", stats.Size)
+	}
+	if stats.Evictions != 3 {
+		t.Fatalf("cache should have evicted 3 patterns, have %d", stats.Evictions)
+	}
+	if _, ok := g.compiledPatterns.items["%{INT:field0}"]; ok {
+		t.Fatal("least recently used pattern should have been evicted")
+	}
+	if _, ok := g.compiledPatterns.items["%{INT:field4}"]; !ok {
+		t.Fatal("most recently used pattern should be cached")
+	}
+}
+
+func TestMaxCompiledPatternsRecency(t *testing.T) {
+	g, _ := NewWithConfig(&Config{MaxCompiledPatterns: 2})
+	g.Parse("%{INT:a}", "1")
+	g.Parse("%{INT:b}", "1")
+	g.Parse("%{INT:a}", "1")
+	g.Parse("%{INT:c}", "1")
+
+	if _, ok := g.compiledPatterns.items["%{INT:a}"]; !ok {
+		t.Fatal("recently used pattern should be kept")
+	}
+	if _, ok := g.compiledPatterns.items["%{INT:b}"]; ok {
+		t.Fatal("least recently used pattern should have been evicted")
+	}
+}
+
+func TestMaxCompiledPatternsEvictionKeepsNames(t *testing.T) {
+	g, _ := NewWithConfig(&Config{MaxCompiledPatterns: 1})
+
+	compiled, err := g.Compile("%{WORD:greeting}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// evicts the held expression from the cache
+	if _, err := g.Parse("%{INT:[user][id]}", "42"); err != nil {
+		t.Fatal(err)
+	}
+	if captures, _ := compiled.Parse("hello"); !reflect.DeepEqual(captures, map[string]string{"greeting": "hello"}) {
+		t.Fatalf("evicted expression should keep its field names, have %v", captures)
+	}
+
+	captures, _ := g.Parse("%{COMMONAPACHELOG}", `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`)
+	g.Parse("%{INT}", "42")
+	captures, _ = g.Parse("%{COMMONAPACHELOG}", `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`)
+	if captures["clientip"] != "127.0.0.1" {
+		t.Fatalf("clientip should be '127.0.0.1' have '%s'", captures["clientip"])
+	}
+}
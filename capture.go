@@ -0,0 +1,216 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+)
+
+// capture is a named capture of a match.
+type capture struct {
+	semantic string
+	name     string   // field name, the semantic name unless flattened
+	path     []string // nested path of the field, nil when it is not nested
+	value    string
+}
+
+// captures returns the named captures of the leftmost match of gr in text, in
+// the order of the expression, nil when there is no match. Values are
+// modified, empty ones get their default value, and the ones still empty are
+// dropped when Config.RemoveEmptyValues is set.
+// The rules of the patterns whose references took part in the match are
+// returned along with the captures.
+func (g *Grok) captures(gr *gRegexp, text string) ([]capture, []rule, error) {
+	loc, err := gr.submatchIndex(text)
+	if err != nil || loc == nil {
+		return nil, nil, err
+	}
+	return g.matchCaptures(gr, gr.regexp.SubexpNames(), text, loc)
+}
+
+// matchCaptures returns the named captures of a match of gr in text and the
+// rules applying to it, names being the names of the groups whose offsets
+// are loc.
+func (g *Grok) matchCaptures(gr *gRegexp, names []string, text string, loc []int) ([]capture, []rule, error) {
+	captures := make([]capture, 0, len(names))
+	var rules []rule
+	var applied map[string]bool
+	for i, alias := range names {
+		if alias == "" {
+			continue
+		}
+		participated := loc[2*i] >= 0
+		if groupRules, ok := gr.rules[alias]; ok {
+			// a pattern referenced more than once is validated once
+			if participated && !applied[alias] {
+				if applied == nil {
+					applied = map[string]bool{}
+				}
+				applied[alias] = true
+				rules = append(rules, groupRules...)
+			}
+			continue
+		}
+		name := gr.names.name(alias)
+		if !g.selected(gr, name) {
+			continue
+		}
+		var value string
+		if participated {
+			value = text[loc[2*i]:loc[2*i+1]]
+		}
+		value, err := gr.modify(name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		c := capture{semantic: name, name: name, value: value}
+		if path := g.fieldPath(name); len(path) > 0 {
+			if g.config.FlattenNested {
+				c.name = strings.Join(path, ".")
+			} else {
+				c.path = path
+			}
+		}
+		captures = append(captures, c)
+	}
+	captures, err := g.applyDefaults(gr, captures)
+	return captures, rules, err
+}
+
+// applyDefaults replaces the captures of the fields left without value by
+// Config.DuplicateFields with a single capture of their default value, then
+// drops the empty captures when Config.RemoveEmptyValues is set.
+func (g *Grok) applyDefaults(gr *gRegexp, captured []capture) ([]capture, error) {
+	var defaults map[string]string
+	if len(gr.defaults) > 0 || len(g.config.Defaults) > 0 {
+		for _, f := range fields(captured) {
+			if g.config.RemoveEmptyValues {
+				f.values = nonEmpty(f.values)
+			}
+			if len(f.values) > 0 {
+				value, err := g.value(f)
+				if err != nil {
+					return nil, err
+				}
+				if value != "" {
+					continue
+				}
+			}
+			if value := g.defaultValue(gr, f.semantic); value != "" {
+				if defaults == nil {
+					defaults = map[string]string{}
+				}
+				defaults[f.name] = value
+			}
+		}
+	}
+
+	var replaced map[string]bool
+	if defaults != nil {
+		replaced = make(map[string]bool, len(defaults))
+	}
+	kept := captured[:0]
+	for _, c := range captured {
+		if value, ok := defaults[c.name]; ok {
+			if replaced[c.name] {
+				continue
+			}
+			replaced[c.name] = true
+			c.value = value
+		} else if g.config.RemoveEmptyValues && c.value == "" {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, nil
+}
+
+// defaultValue returns the value of an empty capture of the semantic name,
+// set in the expression or else in Config.Defaults.
+func (g *Grok) defaultValue(gr *gRegexp, semantic string) string {
+	if value, ok := gr.defaults[semantic]; ok {
+		return value
+	}
+	return g.config.Defaults[semantic]
+}
+
+// DuplicateFieldPolicy tells which value a semantic name captured more than
+// once in an expression gets, as the timestamp of the alternation of
+// HTTPD20_ERRORLOG and HTTPD24_ERRORLOG.
+type DuplicateFieldPolicy int
+
+const (
+	// DuplicateFieldsOverwrite keeps the value of the last capture, empty
+	// when it did not participate in the match.
+	DuplicateFieldsOverwrite DuplicateFieldPolicy = iota
+	// DuplicateFieldsFirstNonEmpty keeps the first non empty value.
+	DuplicateFieldsFirstNonEmpty
+	// DuplicateFieldsLastNonEmpty keeps the last non empty value.
+	DuplicateFieldsLastNonEmpty
+	// DuplicateFieldsError fails the parsing when a name has several non
+	// empty values.
+	DuplicateFieldsError
+	// DuplicateFieldsCollect gathers the non empty values of a name captured
+	// more than once in a slice with ParseTyped. Parse, whose values are
+	// strings, keeps the first non empty value.
+	DuplicateFieldsCollect
+)
+
+// field is a field name along with the values of its captures, in order.
+type field struct {
+	semantic string
+	name     string
+	path     []string
+	values   []string
+}
+
+// fields groups the captures by semantic name, in the order of their first
+// capture.
+func fields(captured []capture) []field {
+	var fs []field
+	index := make(map[string]int, len(captured))
+	for _, c := range captured {
+		if i, ok := index[c.name]; ok {
+			fs[i].values = append(fs[i].values, c.value)
+			continue
+		}
+		index[c.name] = len(fs)
+		fs = append(fs, field{semantic: c.semantic, name: c.name, path: c.path, values: []string{c.value}})
+	}
+	return fs
+}
+
+// value returns the value of f according to Config.DuplicateFields.
+func (g *Grok) value(f field) (string, error) {
+	if len(f.values) == 1 {
+		return f.values[0], nil
+	}
+	values := nonEmpty(f.values)
+	switch g.config.DuplicateFields {
+	case DuplicateFieldsFirstNonEmpty, DuplicateFieldsCollect:
+		if len(values) > 0 {
+			return values[0], nil
+		}
+	case DuplicateFieldsLastNonEmpty:
+		if len(values) > 0 {
+			return values[len(values)-1], nil
+		}
+	case DuplicateFieldsError:
+		if len(values) > 1 {
+			return "", fmt.Errorf("field %s captured more than once: %q", f.name, values)
+		}
+		if len(values) == 1 {
+			return values[0], nil
+		}
+	}
+	return f.values[len(f.values)-1], nil
+}
+
+func nonEmpty(values []string) []string {
+	var r []string
+	for _, v := range values {
+		if v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
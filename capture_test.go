@@ -0,0 +1,147 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestDefaults(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+
+	captures, err := g.ParseTyped(`%{WORD:verb} (?:%{NUMBER:bytes:int=-1}|-) (?:%{WORD:user=anonymous})?$`, "GET - ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["bytes"] != -1 || captures["user"] != "anonymous" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	values, _ := g.Parse(`%{WORD:verb} (?:%{NUMBER:bytes=0}|-)`, "GET 12")
+	if values["bytes"] != "12" {
+		t.Fatalf("bytes should be '12' have %q", values["bytes"])
+	}
+
+	// a default may be empty
+	values, _ = g.Parse(`(?:%{WORD:w=|upper})?x`, "x")
+	if v, ok := values["w"]; !ok || v != "" {
+		t.Fatalf("w should be empty have %q", v)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	g, _ := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		RemoveEmptyValues: true,
+		Defaults:          map[string]string{"bytes": "0", "auth": "none"},
+	})
+
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 -`
+	captures, err := g.ParseTyped("%{COMMONAPACHELOG}", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["bytes"] != "0" {
+		t.Fatalf("bytes should be '0' have %#v", captures["bytes"])
+	}
+	if captures["auth"] != "-" {
+		t.Fatalf("auth should be '-' have %#v", captures["auth"])
+	}
+
+	// defaults set in the expression take precedence
+	values, _ := g.Parse(`(?:%{NUMBER:bytes=-1}|-)`, "-")
+	if values["bytes"] != "-1" {
+		t.Fatalf("bytes should be '-1' have %q", values["bytes"])
+	}
+}
+
+func TestDuplicateFields(t *testing.T) {
+	// the HTTPD24_ERRORLOG branch does not participate
+	text := `[Mon Aug 31 09:30:48 2015] [error] [client 10.0.0.1] File does not exist: /var/www/favicon.ico`
+	tests := []struct {
+		policy   DuplicateFieldPolicy
+		expected string
+	}{
+		{DuplicateFieldsOverwrite, ""},
+		{DuplicateFieldsFirstNonEmpty, "error"},
+		{DuplicateFieldsLastNonEmpty, "error"},
+		{DuplicateFieldsError, "error"},
+		{DuplicateFieldsCollect, "error"},
+	}
+	for _, test := range tests {
+		g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, DuplicateFields: test.policy})
+		captures, err := g.Parse("%{HTTPD_ERRORLOG}", text)
+		if err != nil {
+			t.Fatalf("policy %d: %v", test.policy, err)
+		}
+		if captures["loglevel"] != test.expected {
+			t.Errorf("policy %d: loglevel should be %q have %q", test.policy, test.expected, captures["loglevel"])
+		}
+	}
+
+	pattern := `%{WORD:w} %{WORD:w} (?:%{WORD:w})?`
+	expected := map[DuplicateFieldPolicy]string{
+		DuplicateFieldsOverwrite:     "",
+		DuplicateFieldsFirstNonEmpty: "a",
+		DuplicateFieldsLastNonEmpty:  "b",
+		DuplicateFieldsCollect:       "a",
+	}
+	for policy, value := range expected {
+		g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, DuplicateFields: policy})
+		captures, _ := g.Parse(pattern, "a b ")
+		if captures["w"] != value {
+			t.Errorf("policy %d: w should be %q have %q", policy, value, captures["w"])
+		}
+	}
+
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, DuplicateFields: DuplicateFieldsError})
+	if _, err := g.Parse(pattern, "a b "); err == nil {
+		t.Fatal("conflicting values should fail")
+	}
+	if _, err := g.ParseTyped(pattern, "a b "); err == nil {
+		t.Fatal("conflicting values should fail")
+	}
+}
+
+func TestDuplicateFieldsTyped(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, DuplicateFields: DuplicateFieldsCollect})
+	captures, err := g.ParseTyped(`%{INT:[n][v]:int},%{INT:[n][v]:int},(?:%{INT:[n][v]:int})?;%{WORD:w}`, "1,2,;x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, ok := captures["n"].(map[string]interface{})["v"].([]interface{})
+	if !ok || len(values) != 2 || values[0] != 1 || values[1] != 2 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	if captures["w"] != "x" {
+		t.Fatalf("single captures should not be collected, have %#v", captures["w"])
+	}
+
+	g, _ = NewWithConfig(&Config{NamedCapturesOnly: true, DuplicateFields: DuplicateFieldsLastNonEmpty})
+	captures, _ = g.ParseTyped(`%{INT:[n][v]:int},%{INT:[n][v]:int},(?:%{INT:[n][v]:int})?`, "1,2,")
+	if captures["n"].(map[string]interface{})["v"] != 2 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+}
+
+func TestDefaultsDuplicateFields(t *testing.T) {
+	pattern := `(?:x%{WORD:f}|y%{NUMBER:f})`
+	for _, policy := range []DuplicateFieldPolicy{DuplicateFieldsFirstNonEmpty, DuplicateFieldsError} {
+		g, _ := NewWithConfig(&Config{
+			NamedCapturesOnly: true,
+			DuplicateFields:   policy,
+			Defaults:          map[string]string{"f": "none"},
+		})
+
+		// the default only replaces a field left empty by the policy
+		values, err := g.Parse(pattern, "y12")
+		if err != nil {
+			t.Fatalf("policy %d: %v", policy, err)
+		}
+		if values["f"] != "12" {
+			t.Fatalf("policy %d: f should be '12' have %q", policy, values["f"])
+		}
+		values, _ = g.Parse(`(?:x%{WORD:f}|y%{NUMBER:f})?$`, "")
+		if values["f"] != "none" {
+			t.Fatalf("policy %d: f should be 'none' have %q", policy, values["f"])
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package grok
+
+import (
+	"sort"
+	"strings"
+)
+
+// CompiledPattern is a grok expression compiled once and applied to many
+// texts, as returned by Compile and CompileWith.
+type CompiledPattern struct {
+	g  *Grok
+	gr *gRegexp
+}
+
+// Compile compiles a grok expression with the loaded patterns.
+func (g *Grok) Compile(pattern string) (*CompiledPattern, error) {
+	return g.CompileWith(pattern, nil)
+}
+
+// CompileWith compiles a grok expression with the definitions of defs layered
+// over the loaded patterns, like the pattern_definitions of a Logstash grok
+// filter. A definition may override a loaded pattern, other patterns
+// referencing it are expanded again. The loaded patterns are left untouched
+// and the result is cached on both the expression and the definitions.
+func (g *Grok) CompileWith(pattern string, defs map[string]string) (*CompiledPattern, error) {
+	gr, err := g.compileWith(pattern, defs)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledPattern{g: g, gr: gr}, nil
+}
+
+// ParseWith parses text with a grok expression using the temporary
+// definitions of defs, see CompileWith.
+func (g *Grok) ParseWith(pattern string, defs map[string]string, text string) (map[string]string, error) {
+	gr, err := g.compileWith(pattern, defs)
+	if err != nil {
+		return nil, err
+	}
+	return g.compiledParse(gr, text)
+}
+
+// Match returns true if the specified text matches the compiled pattern.
+func (c *CompiledPattern) Match(text string) (bool, error) {
+	return c.g.compiledMatch(c.gr, text)
+}
+
+// Parse returns a string map with captured string values, see Grok.Parse.
+func (c *CompiledPattern) Parse(text string) (map[string]string, error) {
+	return c.g.compiledParse(c.gr, text)
+}
+
+// ParseTyped returns a map with the typed captured values, see
+// Grok.ParseTyped.
+func (c *CompiledPattern) ParseTyped(text string) (map[string]interface{}, error) {
+	return c.g.compiledParseTyped(c.gr, text)
+}
+
+// ParseToMultiMap returns a map with the captured values stored in string
+// slices, see Grok.ParseToMultiMap.
+func (c *CompiledPattern) ParseToMultiMap(text string) (map[string][]string, error) {
+	return c.g.compiledParseToMultiMap(c.gr, text)
+}
+
+// String returns the expanded expression.
+func (c *CompiledPattern) String() string {
+	return c.gr.regexp.String()
+}
+
+// layerPatterns returns the loaded patterns with defs layered over them. The
+// loaded patterns are returned as is when defs is empty, they are expanded
+// again from their raw definitions when defs overrides one of them. It must
+// be called with patternsGuard held.
+func (g *Grok) layerPatterns(defs map[string]string) (map[string]*gPattern, error) {
+	if len(defs) == 0 {
+		return g.patterns, nil
+	}
+
+	layered := map[string]*gPattern{}
+	for key := range defs {
+		name, _, err := patternName(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := g.patterns[name]; ok {
+			raw := make(map[string]string, len(g.rawPattern)+len(defs))
+			for k, v := range g.rawPattern {
+				raw[k] = v
+			}
+			for k, v := range defs {
+				setRaw(raw, k, v)
+			}
+			_, err := g.expandPatterns(layered, raw, false)
+			return layered, err
+		}
+	}
+
+	for k, v := range g.patterns {
+		layered[k] = v
+	}
+	_, err := g.expandPatterns(layered, defs, false)
+	return layered, err
+}
+
+// cacheKey returns the key of the compiled cache for pattern expanded with the
+// temporary definitions defs. It is the pattern alone when defs is empty.
+func cacheKey(pattern string, defs map[string]string) string {
+	if len(defs) == 0 {
+		return pattern
+	}
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(pattern)
+	for _, name := range names {
+		key.WriteString("\x00")
+		key.WriteString(name)
+		key.WriteString("\x00")
+		key.WriteString(defs[name])
+	}
+	return key.String()
+}
+
+// splitCacheKey returns the pattern and the temporary definitions of a key
+// built by cacheKey.
+func splitCacheKey(key string) (string, map[string]string) {
+	parts := strings.Split(key, "\x00")
+	if len(parts) == 1 {
+		return key, nil
+	}
+	defs := make(map[string]string, len(parts)/2)
+	for i := 1; i+1 < len(parts); i += 2 {
+		defs[parts[i]] = parts[i+1]
+	}
+	return parts[0], defs
+}
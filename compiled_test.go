@@ -0,0 +1,104 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	c, err := g.Compile("%{IP:client} %{NUMBER:bytes:int}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := c.Match("127.0.0.1 42"); !ok {
+		t.Fatal("compiled pattern should match")
+	}
+	captures, _ := c.Parse("127.0.0.1 42")
+	if captures["client"] != "127.0.0.1" || captures["bytes"] != "42" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+	typed, _ := c.ParseTyped("127.0.0.1 42")
+	if typed["bytes"] != 42 {
+		t.Fatalf("bytes should be 42 have %#v", typed["bytes"])
+	}
+	multi, _ := c.ParseToMultiMap("127.0.0.1 42")
+	if len(multi["client"]) != 1 {
+		t.Fatalf("unexpected captures %v", multi)
+	}
+
+	if _, err := g.Compile("%{NOPE}"); err == nil {
+		t.Fatal("unknown patterns should not compile")
+	}
+}
+
+func TestParseWith(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	defs := map[string]string{
+		"ORDER": `ORD-%{INT:id}`,
+		"LINE":  `%{ORDER:order} by %{USER:user}`,
+	}
+
+	captures, err := g.ParseWith("%{LINE}", defs, "ORD-12 by bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["id"] != "12" || captures["user"] != "bob" || captures["order"] != "ORD-12" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	// the definitions do not leak into the instance
+	if _, err := g.Parse("%{LINE}", "ORD-12 by bob"); err == nil {
+		t.Fatal("temporary definitions should not be loaded")
+	}
+	if _, err := g.PatternDefinition("ORDER"); err == nil {
+		t.Fatal("temporary definitions should not be loaded")
+	}
+
+	if _, err := g.ParseWith("%{LINE}", map[string]string{"LINE": "%{NOPE}"}, "x"); err == nil {
+		t.Fatal("definitions referencing unknown patterns should fail")
+	}
+}
+
+func TestParseWithOverride(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+
+	// overriding USERNAME changes the loaded patterns referencing it
+	defs := map[string]string{"USERNAME": `[A-Z]+`}
+	captures, err := g.ParseWith("%{USER:user}", defs, "bob ALICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["user"] != "ALICE" {
+		t.Fatalf("user should be 'ALICE' have '%s'", captures["user"])
+	}
+
+	captures, _ = g.Parse("%{USER:user}", "bob ALICE")
+	if captures["user"] != "bob" {
+		t.Fatalf("user should be 'bob' have '%s'", captures["user"])
+	}
+}
+
+func TestCompileWithCache(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	a := map[string]string{"X": `a+`}
+	b := map[string]string{"X": `b+`}
+
+	c1, _ := g.CompileWith("%{X:x}", a)
+	c2, _ := g.CompileWith("%{X:x}", b)
+	if c1.String() == c2.String() {
+		t.Fatal("different definitions should give different expressions")
+	}
+	c3, _ := g.CompileWith("%{X:x}", map[string]string{"X": `a+`})
+	if c3.gr != c1.gr {
+		t.Fatal("the compiled expression should be cached on the definitions")
+	}
+	if stats := g.CacheStats(); stats.Size != 2 || stats.Hits != 1 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+
+	pattern, defs := splitCacheKey(cacheKey("%{X:x}", map[string]string{"X": `a+`, "Y": ""}))
+	if pattern != "%{X:x}" || len(defs) != 2 || defs["X"] != "a+" || defs["Y"] != "" {
+		t.Fatalf("cache key should round trip, have %q %v", pattern, defs)
+	}
+}
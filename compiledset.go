@@ -0,0 +1,184 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompiledSet is a set of grok expressions combined in a single alternation,
+// as returned by CompileSet.
+type CompiledSet struct {
+	g        *Grok
+	patterns []string
+	gr       *gRegexp
+	branches []setBranch
+}
+
+// setBranch is an expression of a CompiledSet, captured by the group at index
+// group of the alternation, its own groups following up to end excluded.
+type setBranch struct {
+	gr         *gRegexp
+	group, end int
+	names      []string // names of the groups of the expression
+}
+
+// CompileSet combines grok expressions in a single alternation, a text being
+// matched against all of them in one pass. The expression matching leftmost
+// in the text wins, the first one in order among those matching at the same
+// offset. The captures of each expression keep their own names, types,
+// modifiers and default values. With the default engine, the alternation of
+// many expressions is slower to match than a PatternSet.
+func (g *Grok) CompileSet(patterns []string) (*CompiledSet, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("no expression to combine")
+	}
+	s := &CompiledSet{g: g, patterns: patterns, branches: make([]setBranch, len(patterns))}
+	expressions := make([]string, len(patterns))
+	group := 1
+	for i, pattern := range patterns {
+		gr, err := g.compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		names := gr.regexp.SubexpNames()
+		expressions[i] = "(" + shiftBackreferences(gr.regexp.String(), names, group) + ")"
+
+		names = names[1:]
+		b := setBranch{gr: gr, group: group, end: group + 1 + len(names), names: names}
+		s.branches[i] = b
+		group = b.end
+	}
+
+	re, err := g.engine().Compile(strings.Join(expressions, "|"))
+	if err != nil {
+		return nil, err
+	}
+	if n := len(re.SubexpNames()); n != group {
+		return nil, fmt.Errorf("cannot combine the expressions: %d groups instead of %d", n-1, group-1)
+	}
+	s.gr = &gRegexp{regexp: re}
+	return s, nil
+}
+
+// shiftBackreferences rewrites the backreferences of an expression whose
+// groups follow the group at index offset in the alternation. Named
+// backreferences become numbered ones, the other expressions of the set may
+// name their groups alike.
+func shiftBackreferences(expression string, names []string, offset int) string {
+	var result strings.Builder
+	for i := 0; i < len(expression); i++ {
+		switch c := expression[i]; {
+		case c == '[':
+			end := classEnd(expression, i)
+			result.WriteString(expression[i:end])
+			i = end - 1
+		case c == '\\' && i+1 < len(expression):
+			next := expression[i+1]
+			switch {
+			case next >= '1' && next <= '9':
+				end := i + 1
+				for end < len(expression) && expression[end] >= '0' && expression[end] <= '9' {
+					end++
+				}
+				n, _ := strconv.Atoi(expression[i+1 : end])
+				fmt.Fprintf(&result, "\\%d", n+offset)
+				i = end - 1
+			case strings.HasPrefix(expression[i:], `\k<`) && strings.IndexByte(expression[i:], '>') > 0:
+				end := i + strings.IndexByte(expression[i:], '>')
+				group := 0
+				for j := len(names) - 1; j > 0; j-- {
+					if names[j] == expression[i+3:end] {
+						group = j
+					}
+				}
+				if group == 0 {
+					result.WriteString(expression[i : end+1])
+				} else {
+					fmt.Fprintf(&result, "\\%d", group+offset)
+				}
+				i = end
+			default:
+				result.WriteString(expression[i : i+2])
+				i++
+			}
+		default:
+			result.WriteByte(c)
+		}
+	}
+	return result.String()
+}
+
+// match returns the index of the expression matching text, -1 when none
+// does, along with the offsets of the groups of the alternation.
+func (s *CompiledSet) match(text string) (int, []int, error) {
+	loc, err := s.gr.submatchIndex(text)
+	if loc == nil {
+		return -1, nil, err
+	}
+	for i, b := range s.branches {
+		if loc[2*b.group] >= 0 {
+			return i, loc, nil
+		}
+	}
+	return -1, nil, nil
+}
+
+// captures returns the captures of the expression matching text, along with
+// the rules applying to them.
+func (s *CompiledSet) captures(text string) (int, []capture, []rule, error) {
+	i, loc, err := s.match(text)
+	if i < 0 {
+		return i, nil, nil, err
+	}
+	b := s.branches[i]
+	captured, rules, err := s.g.matchCaptures(b.gr, b.names, text, loc[2*(b.group+1):2*b.end])
+	return i, captured, rules, err
+}
+
+// Patterns returns the expressions of the set, in order.
+func (s *CompiledSet) Patterns() []string {
+	return s.patterns
+}
+
+// Match returns the index of the expression matching text, -1 when none does.
+func (s *CompiledSet) Match(text string) (int, error) {
+	i, _, err := s.match(text)
+	return i, err
+}
+
+// Parse returns the index of the expression matching text along with its
+// captures, see Grok.Parse. The index is -1 when no expression matches.
+func (s *CompiledSet) Parse(text string) (int, map[string]string, error) {
+	i, captured, _, err := s.captures(text)
+	if i < 0 || err != nil {
+		return i, nil, err
+	}
+	captures, err := s.g.orderedCaptures(captured)
+	if err != nil {
+		return i, nil, err
+	}
+	return i, captures.Map(), nil
+}
+
+// ParseTyped returns the index of the expression matching text along with
+// its typed captures, see Grok.ParseTyped.
+func (s *CompiledSet) ParseTyped(text string) (int, map[string]interface{}, error) {
+	i, captured, rules, err := s.captures(text)
+	if i < 0 || err != nil {
+		return i, nil, err
+	}
+	values, err := s.g.typedMap(s.branches[i].gr, captured, rules)
+	return i, values, err
+}
+
+// Schema returns the fields of the expression at index i, see Grok.Schema.
+func (s *CompiledSet) Schema(i int) (Schema, error) {
+	return s.g.Schema(s.patterns[i])
+}
+
+// String returns the combined expression.
+func (s *CompiledSet) String() string {
+	return s.gr.regexp.String()
+}
@@ -0,0 +1,136 @@
+package grok
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileSet(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	set, err := g.CompileSet([]string{
+		`^%{INT:n:int} %{WORD:w|upper}`,
+		`^%{WORD:n} %{INT:w:int}( %{WORD:d=none})?`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each expression keeps its types, modifiers and default values
+	i, typed, err := set.ParseTyped("12 abc")
+	if err != nil || i != 0 || !reflect.DeepEqual(typed, map[string]interface{}{"n": 12, "w": "ABC"}) {
+		t.Fatalf("unexpected result %d, %v, %v", i, typed, err)
+	}
+	i, typed, err = set.ParseTyped("abc 12")
+	if err != nil || i != 1 || !reflect.DeepEqual(typed, map[string]interface{}{"n": "abc", "w": 12, "d": "none"}) {
+		t.Fatalf("unexpected result %d, %v, %v", i, typed, err)
+	}
+	i, values, err := set.Parse("abc 12 x")
+	if err != nil || i != 1 || !reflect.DeepEqual(values, map[string]string{"n": "abc", "w": "12", "d": "x"}) {
+		t.Fatalf("unexpected result %d, %v, %v", i, values, err)
+	}
+	if i, values, err := set.Parse("!"); i != -1 || values != nil || err != nil {
+		t.Fatalf("no expression should match, have %d, %v, %v", i, values, err)
+	}
+
+	schema, _ := set.Schema(0)
+	if len(schema.Fields) != 2 || schema.Fields[0].Type != "int" {
+		t.Fatalf("unexpected schema %v", schema)
+	}
+}
+
+func TestCompileSetLeftmost(t *testing.T) {
+	g, _ := New()
+	set, err := g.CompileSet([]string{`b%{INT:n}`, `%{WORD:w}`, `a%{INT:m}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unnamed captures are kept with NamedCapturesOnly unset
+	i, values, _ := set.Parse("a1 b2")
+	if i != 1 || values["w"] != "a1" || values["WORD"] != "" {
+		t.Fatalf("unexpected result %d, %v", i, values)
+	}
+	if i, _ := set.Match("b2 a1"); i != 0 {
+		t.Fatalf("the first expression should win, have %d", i)
+	}
+
+	if _, err := g.CompileSet(nil); err == nil {
+		t.Fatal("an empty set should be rejected")
+	}
+	if _, err := g.CompileSet([]string{"%{UNKNOWN}"}); err == nil {
+		t.Fatal("an unknown pattern should be reported")
+	}
+}
+
+func TestCompileSetBackreferences(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, Engine: BacktrackEngine{}})
+	set, err := g.CompileSet([]string{
+		`^%{WORD:w}!`,
+		`^(a)\1%{INT:n}`,
+		`^(?<q>x)\k<q>!`,
+		`^(?<q>y)\k<q>%{INT:n}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// backreferences keep referring to the groups of their own expression
+	for text, expected := range map[string]int{"aa12": 1, "ab12": -1, "yy12": 3, "yx12": -1} {
+		i, values, err := set.Parse(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != expected || (i >= 0 && values["n"] != "12") {
+			t.Fatalf("%s: expected expression %d, have %d %v", text, expected, i, values)
+		}
+	}
+}
+
+func TestCompileSetFirewalls(t *testing.T) {
+	g, patterns := firewallSet(t)
+	combined, err := g.CompileSet(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefiltered, _ := g.NewPatternSet(patterns)
+
+	// the expressions are anchored, the first matching one wins as with a
+	// PatternSet
+	for _, line := range firewallLines {
+		i, values, err := combined.ParseTyped(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j, expected, _ := prefiltered.ParseTyped(line)
+		if i != j || !reflect.DeepEqual(values, expected) {
+			t.Fatalf("%s: expected %d %v, have %d %v", line, j, expected, i, values)
+		}
+	}
+}
+
+func BenchmarkCompileSet(b *testing.B) {
+	g, firewalls := firewallSet(b)
+	for _, bench := range []struct {
+		name     string
+		patterns []string
+		lines    []string
+	}{
+		{"small", []string{`^%{INT:a} %{WORD:b}$`, `^%{WORD:a}=%{INT:b}$`, `^%{IP:ip} %{WORD:verb}$`}, []string{"10.0.0.1 GET", "a=1", "!"}},
+		{"firewalls", firewalls, firewallLines},
+	} {
+		combined, _ := g.CompileSet(bench.patterns)
+		prefiltered, _ := g.NewPatternSet(bench.patterns)
+		lines := bench.lines
+
+		b.Run(bench.name+"/combined", func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				combined.Parse(lines[n%len(lines)])
+			}
+		})
+		b.Run(bench.name+"/prefiltered", func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				prefiltered.Parse(lines[n%len(lines)])
+			}
+		})
+	}
+}
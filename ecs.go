@@ -0,0 +1,636 @@
+package grok
+
+import (
+	"embed"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// Values of Config.ECSCompatibility.
+const (
+	// ECSDisabled keeps the legacy field names of the shipped patterns.
+	ECSDisabled = "disabled"
+	// ECSV1 names the fields of the shipped patterns after the Elastic
+	// Common Schema v1, as the ecs-v1 patterns of Logstash.
+	ECSV1 = "v1"
+)
+
+// ecsV1Fields maps the legacy semantic names of the shipped patterns to their
+// ECS v1 names, a type being appended when the field is numeric. Names without
+// an ECS equivalent are kept.
+var ecsV1Fields = map[string]string{
+	// web servers
+	"clientip":    "[source][address]",
+	"clientport":  "[source][port]:int",
+	"ident":       "[apache][access][user][identity]",
+	"auth":        "[user][name]",
+	"verb":        "[http][request][method]",
+	"method":      "[http][request][method]",
+	"request":     "[url][original]",
+	"httpversion": "[http][version]",
+	"response":    "[http][response][status_code]:int",
+	"status_code": "[http][response][status_code]:int",
+	"bytes":       "[http][response][body][bytes]:int",
+	"referrer":    "[http][request][referrer]",
+	"agent":       "[user_agent][original]",
+	"user_agent":  "[user_agent][original]",
+	"uri_path":    "[url][path]",
+	"uri_param":   "[url][query]",
+	"request_id":  "[http][request][id]",
+	"authority":   "[url][domain]",
+	"loglevel":    "[log][level]",
+	"errormsg":    "message",
+	"errorcode":   "[error][code]",
+
+	// processes and syslog
+	"pid":       "[process][pid]:int",
+	"tid":       "[process][thread][id]:int",
+	"program":   "[process][name]",
+	"logsource": "[host][hostname]",
+	"facility":  "[log][syslog][facility][code]:int",
+	"priority":  "[log][syslog][priority]:int",
+	"user":      "[user][name]",
+	"username":  "[user][name]",
+
+	// network
+	"src_ip":        "[source][ip]",
+	"src-ip":        "[source][ip]",
+	"orig_h":        "[source][ip]",
+	"src_port":      "[source][port]:int",
+	"src-port":      "[source][port]:int",
+	"orig_p":        "[source][port]:int",
+	"dst_ip":        "[destination][ip]",
+	"dst-ip":        "[destination][ip]",
+	"resp_h":        "[destination][ip]",
+	"dst_port":      "[destination][port]:int",
+	"dst-port":      "[destination][port]:int",
+	"resp_p":        "[destination][port]:int",
+	"protocol":      "[network][transport]",
+	"src_interface": "[observer][ingress][interface][name]",
+	"dst_interface": "[observer][egress][interface][name]",
+	"action":        "[event][action]",
+	"reason":        "[event][reason]",
+
+	// monitoring
+	"nagios_hostname": "[host][hostname]",
+	"nagios_service":  "[service][name]",
+}
+
+// ecsV1PatternFields overrides ecsV1Fields for the fields of a pattern whose
+// meaning differs.
+var ecsV1PatternFields = map[string]map[string]string{
+	"COMMONAPACHELOG": {
+		"rawrequest": "[apache][access][raw_request]",
+	},
+	"HTTPD24_ERRORLOG": {
+		"module":             "[apache][error][module]",
+		"client":             "[source][address]",
+		"proxy_errorcode":    "[apache][error][proxy][error][code]",
+		"proxy_errormessage": "[apache][error][proxy][error][message]",
+	},
+	"COMMONENVOYACCESSLOG": {
+		"protocol":              "[network][protocol]",
+		"bytes_received":        "[http][request][body][bytes]:int",
+		"bytes_sent":            "[http][response][body][bytes]:int",
+		"response_flags":        "[envoy][response_flags]",
+		"duration":              "[envoy][duration_ms]:int",
+		"upstream_service_time": "[envoy][upstream_service_time_ms]",
+		"tcp_service_time":      "[envoy][tcp_service_time]",
+		"forwarded_for":         "[envoy][forwarded_for]",
+		"upstream_service":      "[envoy][upstream_service]",
+	},
+	"URIHOST": {
+		"port": "[url][port]:int",
+	},
+	"SYSLOGPAMSESSION": {
+		"pam_module":        "[system][auth][pam][module]",
+		"pam_caller":        "[system][auth][pam][origin]",
+		"pam_session_state": "[system][auth][pam][session_state]",
+		"pam_by":            "[system][auth][pam][by]",
+	},
+	"CISCO_TAGGED_SYSLOG": {
+		"syslog_pri": "[log][syslog][priority]:int",
+		"sysloghost": "[host][hostname]",
+		"ciscotag":   "[cisco][asa][tag]",
+	},
+	"NETSCREENSESSIONLOG": {
+		"date":            "timestamp",
+		"device":          "[observer][hostname]",
+		"device_id":       "[netscreen][device_id]",
+		"start_time":      "[netscreen][session][start_time]",
+		"duration":        "[netscreen][session][duration]:int",
+		"policy_id":       "[netscreen][policy_id]",
+		"service":         "[netscreen][service]",
+		"proto":           "[network][iana_number]",
+		"src_zone":        "[observer][ingress][zone]",
+		"dst_zone":        "[observer][egress][zone]",
+		"sent":            "[source][bytes]:int",
+		"rcvd":            "[destination][bytes]:int",
+		"src_xlated_ip":   "[source][nat][ip]",
+		"src_xlated_port": "[source][nat][port]:int",
+		"dst_xlated_ip":   "[destination][nat][ip]",
+		"dst_xlated_port": "[destination][nat][port]:int",
+		"session_id":      "[netscreen][session][id]",
+	},
+	"SHOREWALL": {
+		"nf_host":          "[observer][hostname]",
+		"nf_action1":       "[shorewall][firewall][type]",
+		"nf_action2":       "[shorewall][firewall][action]",
+		"nf_in_interface":  "[observer][ingress][interface][name]",
+		"nf_out_interface": "[observer][egress][interface][name]",
+		"nf_dst_mac":       "[destination][mac]",
+		"nf_src_mac":       "[source][mac]",
+		"nf_src_ip":        "[source][ip]",
+		"nf_dst_ip":        "[destination][ip]",
+		"nf_len":           "[network][bytes]",
+		"nf_tos":           "[iptables][tos]",
+		"nf_prec":          "[iptables][precedence_bits]",
+		"nf_ttl":           "[iptables][ttl]:int",
+		"nf_id":            "[iptables][id]",
+		"nf_protocol":      "[network][transport]",
+		"nf_src_port":      "[source][port]:int",
+		"nf_dst_port":      "[destination][port]:int",
+	},
+	"BRO_HTTP": {
+		"trans_depth":       "[zeek][http][trans_depth]:int",
+		"domain":            "[url][domain]",
+		"uri":               "[url][original]",
+		"request_body_len":  "[http][request][body][bytes]:int",
+		"response_body_len": "[http][response][body][bytes]:int",
+		"status_code":       "[http][response][status_code]",
+		"status_msg":        "[zeek][http][status_msg]",
+		"info_code":         "[zeek][http][info_code]",
+		"info_msg":          "[zeek][http][info_msg]",
+		"filename":          "[zeek][http][filename]",
+		"bro_tags":          "[zeek][http][tags]",
+		"password":          "[url][password]",
+		"proxied":           "[zeek][http][proxied]",
+		"orig_fuids":        "[zeek][http][orig_fuids]",
+		"orig_mime_types":   "[zeek][http][orig_mime_types]",
+		"resp_fuids":        "[zeek][http][resp_fuids]",
+		"resp_mime_types":   "[zeek][http][resp_mime_types]",
+	},
+	"BRO_DNS": {
+		"trans_id":    "[dns][id]:int",
+		"query":       "[dns][question][name]",
+		"qclass":      "[zeek][dns][qclass]",
+		"qclass_name": "[zeek][dns][qclass_name]",
+		"qtype":       "[zeek][dns][qtype]",
+		"qtype_name":  "[dns][question][type]",
+		"rcode":       "[zeek][dns][rcode]",
+		"rcode_name":  "[dns][response_code]",
+		"AA":          "[zeek][dns][AA]",
+		"TC":          "[zeek][dns][TC]",
+		"RD":          "[zeek][dns][RD]",
+		"RA":          "[zeek][dns][RA]",
+		"Z":           "[zeek][dns][Z]",
+		"answers":     "[zeek][dns][answers]",
+		"TTLs":        "[zeek][dns][TTLs]",
+		"rejected":    "[zeek][dns][rejected]",
+	},
+	"BRO_CONN": {
+		"service":        "[network][protocol]",
+		"duration":       "[zeek][connection][duration]:float",
+		"orig_bytes":     "[zeek][connection][orig_bytes]:int",
+		"resp_bytes":     "[zeek][connection][resp_bytes]:int",
+		"conn_state":     "[zeek][connection][state]",
+		"local_orig":     "[zeek][connection][local_orig]",
+		"missed_bytes":   "[zeek][connection][missed_bytes]",
+		"history":        "[zeek][connection][history]",
+		"orig_pkts":      "[source][packets]",
+		"orig_ip_bytes":  "[source][bytes]",
+		"resp_pkts":      "[destination][packets]",
+		"resp_ip_bytes":  "[destination][bytes]",
+		"tunnel_parents": "[zeek][connection][tunnel_parents]",
+	},
+	"BRO_FILES": {
+		"fuid":           "[zeek][files][fuid]",
+		"tx_hosts":       "[server][ip]",
+		"rx_hosts":       "[client][ip]",
+		"conn_uids":      "[zeek][files][session_ids]",
+		"source":         "[zeek][files][source]",
+		"depth":          "[zeek][files][depth]",
+		"analyzers":      "[zeek][files][analyzers]",
+		"mime_type":      "[file][mime_type]",
+		"filename":       "[file][name]",
+		"duration":       "[zeek][files][duration]",
+		"local_orig":     "[zeek][files][local_orig]",
+		"is_orig":        "[zeek][files][is_orig]",
+		"seen_bytes":     "[zeek][files][seen_bytes]",
+		"total_bytes":    "[file][size]",
+		"missing_bytes":  "[zeek][files][missing_bytes]",
+		"overflow_bytes": "[zeek][files][overflow_bytes]",
+		"timedout":       "[zeek][files][timedout]",
+		"parent_fuid":    "[zeek][files][parent_fuid]",
+		"md5":            "[file][hash][md5]",
+		"sha1":           "[file][hash][sha1]",
+		"sha256":         "[file][hash][sha256]",
+		"extracted":      "[zeek][files][extracted]",
+	},
+	"JAVASTACKTRACEPART": {
+		"class":  "[java][log][origin][class][name]",
+		"method": "[log][origin][function]",
+		"file":   "[log][origin][file][name]",
+		"line":   "[log][origin][file][line]:int",
+	},
+	"CATALINALOG": {
+		"class":      "[java][log][origin][class][name]",
+		"logmessage": "message",
+	},
+	"TOMCATLOG": {
+		"level":      "[log][level]",
+		"class":      "[java][log][origin][class][name]",
+		"logmessage": "message",
+	},
+	"POSTGRESQL": {
+		"user_id":       "[user][name]",
+		"connection_id": "[postgresql][log][connection_id]",
+	},
+	"RCONTROLLER": {
+		"controller": "[rails][controller][class]",
+		"action":     "[rails][controller][action]",
+	},
+	"RPROCESSING": {
+		"format": "[rails][request][format]",
+		"params": "[rails][request][params]",
+	},
+	"RAILS3FOOT": {
+		"totalms": "[rails][request][duration][total]:float",
+	},
+	"RAILS3PROFILE": {
+		"viewms":         "[rails][request][duration][view]:float",
+		"activerecordms": "[rails][request][duration][active_record]:float",
+	},
+	"RAILS3": {
+		"context": "message",
+	},
+	"RUBY_LOGGER": {
+		"progname": "[process][name]",
+	},
+}
+
+// ecsV1FormatFields overrides ecsV1Fields for the fields of the patterns of a
+// log format, by prefix of their names. ecsV1PatternFields takes precedence.
+var ecsV1FormatFields = map[string]map[string]string{
+	"BACULA_": {
+		"bts":       "timestamp",
+		"hostname":  "[host][hostname]",
+		"jobid":     "[bacula][job][id]:int",
+		"volume":    "[bacula][volume][name]",
+		"device":    "[bacula][volume][device]",
+		"client":    "[bacula][client][name]",
+		"job":       "[bacula][job][name]",
+		"berror":    "[error][message]",
+		"elapsed":   "[bacula][job][elapsed_time]",
+		"runjob":    "[bacula][job][client_run_before_command]",
+		"duplicate": "[bacula][job][other_id]:int",
+	},
+	"BRO_": {
+		"ts":    "timestamp",
+		"uid":   "[zeek][session_id]",
+		"proto": "[network][transport]",
+	},
+	"CISCOFW": {
+		"switch_reason":           "[event][reason]",
+		"interface_name":          "[cisco][asa][interface][name]",
+		"direction":               "[cisco][asa][network][direction]",
+		"tcp_flags":               "[cisco][asa][tcp_flags]",
+		"interface":               "[observer][ingress][interface][name]",
+		"src_fwuser":              "[source][user][name]",
+		"dst_fwuser":              "[destination][user][name]",
+		"fwuser":                  "[destination][user][name]",
+		"icmp_type":               "[cisco][asa][icmp_type]:int",
+		"icmp_code":               "[cisco][asa][icmp_code]:int",
+		"policy_id":               "[cisco][asa][rule_name]",
+		"hashcode1":               "[cisco][asa][hashcode1]",
+		"hashcode2":               "[cisco][asa][hashcode2]",
+		"hit_count":               "[cisco][asa][hit_count]:int",
+		"interval":                "[cisco][asa][interval]",
+		"connection_count":        "[cisco][asa][connections][in_use]:int",
+		"connection_count_max":    "[cisco][asa][connections][most_used]:int",
+		"connection_id":           "[cisco][asa][connection_id]",
+		"src_mapped_ip":           "[source][nat][ip]",
+		"src_mapped_port":         "[source][nat][port]:int",
+		"dst_mapped_ip":           "[destination][nat][ip]",
+		"dst_mapped_port":         "[destination][nat][port]:int",
+		"duration":                "[event][duration]",
+		"bytes":                   "[network][bytes]:int",
+		"icmp_seq_num":            "[cisco][asa][icmp_seq_num]:int",
+		"src_xlated_ip":           "[source][nat][ip]",
+		"src_xlated_port":         "[source][nat][port]",
+		"src_xlated_interface":    "[observer][egress][interface][name]",
+		"icmp_code_xlated":        "[cisco][asa][icmp_code_xlated]:int",
+		"xlate_type":              "[cisco][asa][xlate_type]",
+		"err_protocol":            "[cisco][asa][icmp_error][protocol]",
+		"err_src_interface":       "[cisco][asa][icmp_error][source][interface]",
+		"err_src_ip":              "[cisco][asa][icmp_error][source][ip]",
+		"err_src_fwuser":          "[cisco][asa][icmp_error][source][user]",
+		"err_dst_interface":       "[cisco][asa][icmp_error][destination][interface]",
+		"err_dst_ip":              "[cisco][asa][icmp_error][destination][ip]",
+		"err_dst_fwuser":          "[cisco][asa][icmp_error][destination][user]",
+		"err_icmp_type":           "[cisco][asa][icmp_error][icmp_type]:int",
+		"err_icmp_code":           "[cisco][asa][icmp_error][icmp_code]:int",
+		"orig_src_ip":             "[source][ip]",
+		"orig_src_port":           "[source][port]:int",
+		"orig_src_fwuser":         "[source][user][name]",
+		"orig_dst_ip":             "[destination][ip]",
+		"orig_dst_port":           "[destination][port]:int",
+		"orig_dst_fwuser":         "[destination][user][name]",
+		"resource_name":           "[cisco][asa][resource][name]",
+		"resource_limit":          "[cisco][asa][resource][limit]:int",
+		"orig_protocol":           "[cisco][asa][original_protocol]",
+		"spi":                     "[cisco][asa][spi]",
+		"seq_num":                 "[cisco][asa][sequence_number]",
+		"tunnel_type":             "[cisco][asa][tunnel_type]",
+		"group":                   "[cisco][asa][group]",
+		"is_remote_natted":        "[cisco][asa][remote_natted]",
+		"is_local_natted":         "[cisco][asa][local_natted]",
+		"drop_type":               "[cisco][asa][burst][object]",
+		"drop_rate_id":            "[cisco][asa][burst][id]",
+		"drop_rate_current_burst": "[cisco][asa][burst][current_burst_rate]:int",
+		"drop_rate_max_burst":     "[cisco][asa][burst][configured_burst_rate]:int",
+		"drop_rate_current_avg":   "[cisco][asa][burst][current_average_rate]:int",
+		"drop_rate_max_avg":       "[cisco][asa][burst][configured_average_rate]:int",
+		"drop_total_count":        "[cisco][asa][burst][cumulative_count]:int",
+	},
+	"ELB_": {
+		"elb":                      "[aws][elb][name]",
+		"backendip":                "[aws][elb][backend][ip]",
+		"backendport":              "[aws][elb][backend][port]:int",
+		"request_processing_time":  "[aws][elb][request_processing_time][sec]:float",
+		"backend_processing_time":  "[aws][elb][backend_processing_time][sec]:float",
+		"response_processing_time": "[aws][elb][response_processing_time][sec]:float",
+		"backend_response":         "[aws][elb][backend][http][response][status_code]:int",
+		"received_bytes":           "[http][request][body][bytes]:int",
+		"rawrequest":               "[aws][elb][raw_request]",
+		"proto":                    "[url][scheme]",
+		"urihost":                  "[url][domain]",
+		"path":                     "[url][path]",
+		"params":                   "[url][query]",
+	},
+	"EXIM_": {
+		"exim_year":           "[exim][log][date][year]",
+		"exim_month":          "[exim][log][date][month]",
+		"exim_day":            "[exim][log][date][day]",
+		"exim_time":           "[exim][log][date][time]",
+		"remote_hostname":     "[source][domain]",
+		"remote_heloname":     "[exim][log][helo][name]",
+		"remote_host":         "[source][ip]",
+		"exim_interface":      "[destination][ip]",
+		"exim_interface_port": "[destination][port]:int",
+		"protocol":            "[network][protocol]",
+		"exim_msg_size":       "[exim][log][message][body][size]:int",
+		"exim_header_id":      "[exim][log][header_id]",
+		"exim_subject":        "[exim][log][message][subject]",
+	},
+	"HAPROXY": {
+		"syslog_timestamp":          "timestamp",
+		"syslog_server":             "[host][hostname]",
+		"client_ip":                 "[source][address]",
+		"client_port":               "[source][port]:int",
+		"accept_date":               "[haproxy][request_date]",
+		"haproxy_monthday":          "[haproxy][date][day]",
+		"haproxy_month":             "[haproxy][date][month]",
+		"haproxy_year":              "[haproxy][date][year]",
+		"haproxy_time":              "[haproxy][date][time]",
+		"haproxy_milliseconds":      "[haproxy][date][milliseconds]",
+		"haproxy_hour":              "[haproxy][time][hour]",
+		"haproxy_minute":            "[haproxy][time][minute]",
+		"haproxy_second":            "[haproxy][time][second]",
+		"frontend_name":             "[haproxy][frontend_name]",
+		"backend_name":              "[haproxy][backend_name]",
+		"server_name":               "[haproxy][server_name]",
+		"time_request":              "[haproxy][http][request][time_wait_ms]:int",
+		"time_queue":                "[haproxy][total_waiting_time_ms]:int",
+		"time_backend_connect":      "[haproxy][connection_wait_time_ms]:int",
+		"time_backend_response":     "[haproxy][http][request][time_wait_without_data_ms]:int",
+		"time_duration":             "[haproxy][total_time_ms]",
+		"http_status_code":          "[http][response][status_code]:int",
+		"bytes_read":                "[haproxy][bytes_read]",
+		"captured_request_cookie":   "[haproxy][http][request][captured_cookie]",
+		"captured_response_cookie":  "[haproxy][http][response][captured_cookie]",
+		"captured_request_headers":  "[haproxy][http][request][captured_headers]",
+		"captured_response_headers": "[haproxy][http][response][captured_headers]",
+		"termination_state":         "[haproxy][termination_state]",
+		"actconn":                   "[haproxy][connections][active]:int",
+		"feconn":                    "[haproxy][connections][frontend]:int",
+		"beconn":                    "[haproxy][connections][backend]:int",
+		"srvconn":                   "[haproxy][connections][server]:int",
+		"retries":                   "[haproxy][connections][retries]",
+		"srv_queue":                 "[haproxy][server_queue]:int",
+		"backend_queue":             "[haproxy][backend_queue]:int",
+		"http_verb":                 "[http][request][method]",
+		"http_proto":                "[url][scheme]",
+		"http_user":                 "[url][username]",
+		"http_host":                 "[url][domain]",
+		"http_request":              "[url][original]",
+		"http_version":              "[http][version]",
+	},
+	"MCOLLECTIVE": {
+		"event_level": "[log][level]",
+	},
+	"MONGO": {
+		"severity":   "[log][level]",
+		"component":  "[mongodb][component]",
+		"context":    "[mongodb][context]",
+		"database":   "[mongodb][database]",
+		"collection": "[mongodb][collection]",
+		"query":      "[mongodb][query][original]",
+		"ntoreturn":  "[mongodb][query][ntoreturn]:int",
+		"ntoskip":    "[mongodb][query][ntoskip]:int",
+		"nscanned":   "[mongodb][query][nscanned]:int",
+		"nreturned":  "[mongodb][query][nreturned]:int",
+		"duration":   "[mongodb][duration][ms]:int",
+	},
+	"NAGIOS": {
+		"nagios_epoch":              "timestamp",
+		"nagios_type":               "[nagios][log][type]",
+		"nagios_state":              "[service][state]",
+		"nagios_statetype":          "[nagios][log][state_type]",
+		"nagios_statelevel":         "[nagios][log][state_level]",
+		"nagios_statecode":          "[nagios][log][state_code]",
+		"nagios_attempt":            "[nagios][log][attempt]:int",
+		"nagios_message":            "message",
+		"nagios_comment":            "[nagios][log][comment]",
+		"nagios_notifyname":         "[user][name]",
+		"nagios_contact":            "[nagios][log][notification_command]",
+		"nagios_event_handler_name": "[nagios][log][event_handler_name]",
+		"nagios_command":            "[nagios][log][command]",
+		"nagios_check_result":       "[nagios][log][check_result]",
+		"nagios_start_time":         "[nagios][log][start_time]",
+		"nagios_end_time":           "[nagios][log][end_time]",
+		"nagios_fixed":              "[nagios][log][fixed]",
+		"nagios_trigger_id":         "[nagios][log][trigger_id]",
+		"nagios_duration":           "[nagios][log][duration]",
+		"nagios_unknown1":           "[nagios][log][period_from]",
+		"nagios_unknown2":           "[nagios][log][period_to]",
+		"author":                    "[nagios][log][author]",
+		"comment":                   "[nagios][log][downtime_comment]",
+	},
+	"RT_FLOW": {
+		"event":             "[juniper][srx][tag]",
+		"close-reason":      "[juniper][srx][reason]",
+		"service":           "[juniper][srx][service_name]",
+		"nat-src-ip":        "[source][nat][ip]",
+		"nat-src-port":      "[source][nat][port]:int",
+		"nat-dst-ip":        "[destination][nat][ip]",
+		"nat-dst-port":      "[destination][nat][port]:int",
+		"src-nat-rule-name": "[juniper][srx][src_nat_rule_name]",
+		"dst-nat-rule-name": "[juniper][srx][dst_nat_rule_name]",
+		"protocol-id":       "[network][iana_number]",
+		"policy-name":       "[juniper][srx][policy_name]",
+		"from-zone":         "[juniper][srx][from_zone]",
+		"to-zone":           "[juniper][srx][to_zone]",
+		"session-id":        "[juniper][srx][session_id]",
+		"sent":              "[source][bytes]",
+		"received":          "[destination][bytes]",
+		"elapsed-time":      "[juniper][srx][elapsed_time]:int",
+	},
+	"S3_": {
+		"owner":              "[aws][s3access][bucket_owner]",
+		"bucket":             "[aws][s3access][bucket]",
+		"requester":          "[aws][s3access][requester]",
+		"request_id":         "[aws][s3access][request_id]",
+		"operation":          "[aws][s3access][operation]",
+		"key":                "[aws][s3access][key]",
+		"error_code":         "[aws][s3access][error_code]",
+		"object_size":        "[aws][s3access][object_size]:int",
+		"request_time_ms":    "[aws][s3access][total_time]:int",
+		"turnaround_time_ms": "[aws][s3access][turn_around_time]:int",
+		"version_id":         "[aws][s3access][version_id]",
+		"rawrequest":         "[aws][s3access][request_uri]",
+	},
+	"SYSLOG5424": {
+		"syslog5424_pri":   "[log][syslog][priority]:int",
+		"syslog5424_ver":   "[system][syslog][version]",
+		"syslog5424_ts":    "timestamp",
+		"syslog5424_host":  "[host][hostname]",
+		"syslog5424_app":   "[process][name]",
+		"syslog5424_proc":  "[process][pid]",
+		"syslog5424_msgid": "[event][code]",
+		"syslog5424_sd":    "[system][syslog][structured_data]",
+		"syslog5424_msg":   "message",
+	},
+}
+
+// ecsPatterns returns the patterns of m with the field names selected by
+// Config.ECSCompatibility. m is returned as is when it is disabled.
+func (g *Grok) ecsPatterns(m map[string]string) map[string]string {
+	if g.config.ECSCompatibility != ECSV1 {
+		return m
+	}
+	renamed := make(map[string]string, len(m))
+	for key, pattern := range m {
+		name, _, _ := patternName(key)
+		renamed[key] = ecsRename(name, pattern)
+	}
+	return renamed
+}
+
+// ecsShippedPatterns returns the patterns of m with the field names selected
+// by Config.ECSCompatibility for those defined as in the shipped pattern
+// files.
+func (g *Grok) ecsShippedPatterns(m map[string]string) map[string]string {
+	if g.config.ECSCompatibility != ECSV1 {
+		return m
+	}
+	shipped := shippedPatterns()
+	renamed := make(map[string]string, len(m))
+	for key, pattern := range m {
+		renamed[key] = pattern
+		if shipped[key][pattern] {
+			name, _, _ := patternName(key)
+			renamed[key] = ecsRename(name, pattern)
+		}
+	}
+	return renamed
+}
+
+// ecsField returns the ECS v1 name of the semantic name of a field of the
+// named pattern.
+func ecsField(name, semantic string) (string, bool) {
+	if field, ok := ecsV1PatternFields[name][semantic]; ok {
+		return field, true
+	}
+	for prefix, fields := range ecsV1FormatFields {
+		if field, ok := fields[semantic]; ok && strings.HasPrefix(name, prefix) {
+			return field, true
+		}
+	}
+	field, ok := ecsV1Fields[semantic]
+	return field, ok
+}
+
+// ecsRename renames the fields of the references and of the named groups of
+// the named pattern.
+func ecsRename(name, pattern string) string {
+	// field is the ECS v1 name of a semantic name followed by its type,
+	// default or modifiers
+	field := func(s string) string {
+		end := strings.IndexAny(s, ":=|")
+		if end < 0 {
+			end = len(s)
+		}
+		semantic, rest := s[:end], s[end:]
+		field, ok := ecsField(name, semantic)
+		if !ok {
+			return s
+		}
+		if strings.HasPrefix(rest, ":") {
+			// the declared type wins
+			field = strings.SplitN(field, ":", 2)[0]
+		}
+		return field + rest
+	}
+
+	var renamed strings.Builder
+	last := 0
+	for _, group := range onigGroups(pattern) {
+		renamed.WriteString(pattern[last:group[2]])
+		renamed.WriteString(field(pattern[group[2]:group[3]]))
+		last = group[3]
+	}
+	renamed.WriteString(pattern[last:])
+
+	return normal.ReplaceAllStringFunc(renamed.String(), func(ref string) string {
+		content := ref[2 : len(ref)-1]
+		parts := strings.SplitN(content, ":", 2)
+		if len(parts) < 2 {
+			return ref
+		}
+		return "%{" + parts[0] + ":" + field(parts[1]) + "}"
+	})
+}
+
+//go:embed patterns
+var shippedPatternFiles embed.FS
+
+var (
+	shippedOnce sync.Once
+	shipped     map[string]map[string]bool
+)
+
+// shippedPatterns returns the expressions of the patterns of the shipped
+// pattern files by pattern name.
+func shippedPatterns() map[string]map[string]bool {
+	shippedOnce.Do(func() {
+		shipped = map[string]map[string]bool{}
+		files, _ := fs.Glob(shippedPatternFiles, "patterns/*")
+		for _, file := range files {
+			f, err := shippedPatternFiles.Open(file)
+			if err != nil {
+				continue
+			}
+			defs, _ := readPatterns(f, file)
+			f.Close()
+			for _, def := range defs {
+				if shipped[def.name] == nil {
+					shipped[def.name] = map[string]bool{}
+				}
+				shipped[def.name][def.expression] = true
+			}
+		}
+	})
+	return shipped
+}
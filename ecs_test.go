@@ -0,0 +1,173 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestECSCompatibility(t *testing.T) {
+	g, err := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		ECSCompatibility:  ECSV1,
+		ECSPatternsDir:    true,
+		PatternsDir:       []string{"./patterns"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+	captures, err := g.ParseTyped("%{COMMONAPACHELOG}", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := captures["source"].(map[string]interface{})
+	if source["address"] != "127.0.0.1" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	http := captures["http"].(map[string]interface{})
+	if http["request"].(map[string]interface{})["method"] != "GET" || http["version"] != "1.1" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	response := http["response"].(map[string]interface{})
+	if response["status_code"] != 404 || response["body"].(map[string]interface{})["bytes"] != 207 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	if captures["url"].(map[string]interface{})["original"] != "/index.php" || captures["timestamp"] == nil {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	// fields of the shipped pattern files are renamed as well
+	fields, err := g.Fields("%{CISCOFW106001}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range fields {
+		found = found || f.Name == "[source][ip]"
+	}
+	if !found {
+		t.Fatalf("src_ip should be renamed, have %+v", fields)
+	}
+
+	// patterns added afterwards keep their names
+	g.AddPattern("MINE", `%{IP:clientip}`)
+	values, _ := g.Parse("%{MINE}", "10.0.0.1")
+	if values["clientip"] != "10.0.0.1" {
+		t.Fatalf("unexpected captures %#v", values)
+	}
+}
+
+func TestECSUserPatternFiles(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom", "MINE %{IP:clientip} %{WORD:verb}\n")
+
+	g, err := NewWithConfig(&Config{NamedCapturesOnly: true, ECSCompatibility: ECSV1, PatternsDir: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := g.Parse("%{MINE}", "10.0.0.1 GET")
+	if values["clientip"] != "10.0.0.1" || values["verb"] != "GET" {
+		t.Fatalf("user patterns should keep their field names, have %#v", values)
+	}
+
+	// the default patterns are renamed
+	values, _ = g.Parse("%{COMMONAPACHELOG}", `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET / HTTP/1.1" 404 207`)
+	if values["[source][address]"] != "127.0.0.1" {
+		t.Fatalf("unexpected captures %#v", values)
+	}
+}
+
+func TestECSDisabled(t *testing.T) {
+	for _, mode := range []string{"", ECSDisabled} {
+		g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, ECSCompatibility: mode})
+		values, _ := g.Parse("%{COMMONAPACHELOG}", `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET / HTTP/1.1" 404 207`)
+		if values["clientip"] != "127.0.0.1" {
+			t.Fatalf("legacy names should be kept, have %#v", values)
+		}
+	}
+
+	if _, err := NewWithConfig(&Config{ECSCompatibility: "v8"}); err == nil {
+		t.Fatal("unknown ECS versions should be rejected")
+	}
+}
+
+func TestECSShippedPatterns(t *testing.T) {
+	config := func(ecs string) *Config {
+		return &Config{
+			NamedCapturesOnly: true,
+			ECSCompatibility:  ecs,
+			ECSPatternsDir:    true,
+			PatternsDir:       []string{"./patterns"},
+		}
+	}
+	g, err := NewWithConfig(config(ECSV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := NewWithConfig(config(ECSDisabled))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// names ECS leaves to the pipeline, as the ecs-v1 patterns of Logstash
+	kept := map[string]bool{"message": true, "timestamp": true, "timestamp8601": true}
+	// alternations whose branches share their ECS names
+	merged := map[string]bool{"HTTPD_ERRORLOG": true}
+	for _, name := range g.Patterns() {
+		schema, err := g.Schema("%{" + name + "}")
+		if err != nil {
+			// patterns out of reach of the engine
+			continue
+		}
+		paths := map[string]bool{}
+		for _, f := range schema.Fields {
+			if len(f.Path) == 0 && !kept[f.Name] {
+				t.Errorf("%s keeps the legacy field %s", name, f.Name)
+			}
+			paths[f.Name] = true
+		}
+		for _, f := range schema.Fields {
+			for i := 1; i < len(f.Path); i++ {
+				if parent := "[" + strings.Join(f.Path[:i], "][") + "]"; paths[parent] {
+					t.Errorf("%s captures both %s and %s", name, parent, f.Name)
+				}
+			}
+		}
+		if old, err := legacy.Schema("%{" + name + "}"); err == nil && !merged[name] && len(old.Fields) != len(schema.Fields) {
+			t.Errorf("%s merges fields: %d fields instead of %d", name, len(schema.Fields), len(old.Fields))
+		}
+	}
+}
+
+func TestECSPatternsDirShippedOnly(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom", "MINE %{IP:clientip}\nCISCOFW106021 %{IP:src_ip} %{GREEDYDATA:interface}\n")
+
+	g, err := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		ECSCompatibility:  ECSV1,
+		ECSPatternsDir:    true,
+		PatternsDir:       []string{"./patterns", dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := g.Parse("%{MINE}", "10.0.0.1")
+	if values["clientip"] != "10.0.0.1" {
+		t.Fatalf("user patterns should keep their field names, have %#v", values)
+	}
+	values, _ = g.Parse("%{CISCOFW106021}", "10.0.0.1 outside")
+	if values["src_ip"] != "10.0.0.1" || values["interface"] != "outside" {
+		t.Fatalf("redefined shipped patterns should keep their field names, have %#v", values)
+	}
+
+	// Oniguruma named groups are renamed as well
+	fields, err := g.Fields("%{RCONTROLLER}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || fields[0].Name != "[rails][controller][class]" || fields[1].Name != "[rails][controller][action]" {
+		t.Fatalf("unexpected fields %+v", fields)
+	}
+}
@@ -0,0 +1,95 @@
+package grok
+
+import (
+	"regexp"
+)
+
+// Engine compiles the expanded expressions of grok patterns. The engine used
+// by a Grok object is selected with Config.Engine.
+type Engine interface {
+	Compile(expression string) (Regexp, error)
+}
+
+// Regexp is an expression compiled by an Engine.
+type Regexp interface {
+	// MatchString reports whether s contains a match of the expression.
+	MatchString(s string) bool
+	// FindStringSubmatchIndex returns the pairs of offsets of the leftmost
+	// match of the expression in s and of its subexpressions, -1 marking
+	// the subexpressions that did not participate. It returns nil when
+	// there is no match.
+	FindStringSubmatchIndex(s string) []int
+	// SubexpNames returns the names of the subexpressions, the first one
+	// being the whole expression.
+	SubexpNames() []string
+	// String returns the source text of the expression.
+	String() string
+}
+
+// ExtendedEngine is implemented by engines supporting constructs out of
+// reach of RE2. Supports is called with the CompatError.Construct values.
+type ExtendedEngine interface {
+	Engine
+	Supports(construct string) bool
+}
+
+// fallibleRegexp is implemented by Regexp values that may give up on a text,
+// such as the ones compiled by BacktrackEngine.
+type fallibleRegexp interface {
+	FindStringSubmatchIndexErr(s string) ([]int, error)
+}
+
+// RE2Engine compiles expressions with the regexp package of the standard
+// library, which guarantees a matching time linear in the size of the text.
+// It is the default engine.
+type RE2Engine struct{}
+
+// Compile compiles expression with regexp.Compile.
+func (RE2Engine) Compile(expression string) (Regexp, error) {
+	return regexp.Compile(expression)
+}
+
+// engine returns the engine configured for g.
+func (g *Grok) engine() Engine {
+	if g.config.Engine != nil {
+		return g.config.Engine
+	}
+	return RE2Engine{}
+}
+
+// supports reports whether the configured engine handles the construct.
+func (g *Grok) supports(construct string) bool {
+	e, ok := g.engine().(ExtendedEngine)
+	return ok && e.Supports(construct)
+}
+
+// submatch returns the text of the leftmost match of gr in text and of its
+// subexpressions, nil when there is no match.
+func (gr *gRegexp) submatch(text string) ([]string, error) {
+	loc, err := gr.submatchIndex(text)
+	if loc == nil {
+		return nil, err
+	}
+
+	match := make([]string, len(loc)/2)
+	for i := range match {
+		if loc[2*i] >= 0 {
+			match[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return match, nil
+}
+
+// submatchIndex returns the offsets of the leftmost match of gr in text and
+// of its subexpressions, nil when there is no match.
+func (gr *gRegexp) submatchIndex(text string) ([]int, error) {
+	if re, ok := gr.regexp.(fallibleRegexp); ok {
+		return re.FindStringSubmatchIndexErr(text)
+	}
+	return gr.regexp.FindStringSubmatchIndex(text), nil
+}
+
+// numSubexp returns the number of subexpressions of gr.
+func (gr *gRegexp) numSubexp() int {
+	return len(gr.regexp.SubexpNames()) - 1
+}
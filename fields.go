@@ -0,0 +1,95 @@
+package grok
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// ParseFields parses the specified text and returns a map with the requested
+// fields only, named by their semantic names or, with Config.FlattenNested,
+// by their dotted paths. The captures of the other fields are turned into
+// non-capturing groups when the expression is compiled.
+func (g *Grok) ParseFields(pattern, text string, fields ...string) (map[string]string, error) {
+	gr, err := g.compileFields(pattern, nil, selection(fields))
+	if err != nil {
+		return nil, err
+	}
+	return g.compiledParse(gr, text)
+}
+
+// CompileFields compiles a grok expression whose results only hold the
+// requested fields, see ParseFields.
+func (g *Grok) CompileFields(pattern string, fields ...string) (*CompiledPattern, error) {
+	gr, err := g.compileFields(pattern, nil, selection(fields))
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledPattern{g: g, gr: gr}, nil
+}
+
+// selection returns the sorted requested fields, an empty selection keeping
+// no field.
+func selection(fields []string) []string {
+	sorted := append(make([]string, 0, len(fields)), fields...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// fieldsKey returns the key of the compiled cache for the key of an
+// expression whose results only hold fields. It is the key alone when fields
+// is nil, which keeps every field.
+func fieldsKey(key string, fields []string) string {
+	if fields == nil {
+		return key
+	}
+	return key + "\x01" + strings.Join(fields, "\x01")
+}
+
+// splitFieldsKey returns the key of the expression and the fields of a key
+// built by fieldsKey.
+func splitFieldsKey(key string) (string, []string) {
+	i := strings.IndexByte(key, '\x01')
+	if i < 0 {
+		return key, nil
+	}
+	fields := []string{}
+	for _, field := range strings.Split(key[i+1:], "\x01") {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return key[:i], fields
+}
+
+// selected reports whether the captures of the semantic name belong to the
+// results of gr.
+func (g *Grok) selected(gr *gRegexp, semantic string) bool {
+	if gr.fields == nil || gr.fields[semantic] {
+		return true
+	}
+	path := g.fieldPath(semantic)
+	return len(path) > 0 && g.config.FlattenNested && gr.fields[strings.Join(path, ".")]
+}
+
+// stripCaptures turns the capturing groups of expression that keep rejects
+// into non-capturing groups, keep being called with the group names, empty
+// for unnamed groups. Expressions with constructs RE2 rejects are returned as
+// is.
+func stripCaptures(expression string, keep func(name string) bool) string {
+	re, err := syntax.Parse(expression, syntax.Perl)
+	if err != nil {
+		return expression
+	}
+	var strip func(re *syntax.Regexp) *syntax.Regexp
+	strip = func(re *syntax.Regexp) *syntax.Regexp {
+		for i, sub := range re.Sub {
+			re.Sub[i] = strip(sub)
+		}
+		if re.Op == syntax.OpCapture && !keep(re.Name) {
+			return re.Sub[0]
+		}
+		return re
+	}
+	return strip(re).String()
+}
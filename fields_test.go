@@ -0,0 +1,180 @@
+package grok
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const apacheLine = `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+
+func TestParseFields(t *testing.T) {
+	for _, namedOnly := range []bool{false, true} {
+		g, _ := NewWithConfig(&Config{NamedCapturesOnly: namedOnly})
+
+		values, err := g.ParseFields("%{COMMONAPACHELOG}", apacheLine, "clientip", "response")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{"clientip": "127.0.0.1", "response": "404"}
+		if !reflect.DeepEqual(values, expected) {
+			t.Fatalf("expected %v, have %v", expected, values)
+		}
+
+		// unknown fields are ignored, an empty selection keeps no field
+		values, _ = g.ParseFields("%{COMMONAPACHELOG}", apacheLine, "verb", "unknown")
+		if !reflect.DeepEqual(values, map[string]string{"verb": "GET"}) {
+			t.Fatalf("unexpected result %v", values)
+		}
+		values, _ = g.ParseFields("%{COMMONAPACHELOG}", apacheLine)
+		if len(values) != 0 {
+			t.Fatalf("unexpected result %v", values)
+		}
+
+		// the expression without selection is left untouched
+		values, _ = g.Parse("%{COMMONAPACHELOG}", apacheLine)
+		if values["bytes"] != "207" {
+			t.Fatalf("unexpected result %v", values)
+		}
+	}
+}
+
+func TestCompileFields(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, FlattenNested: true})
+	c, err := g.CompileFields(`%{IP:[source][ip]} (%{WORD:verb}|-) %{INT:code:int}`, "source.ip", "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := regexp.MustCompile(c.String()).NumSubexp(); n != 2 {
+		t.Fatalf("the other groups should not capture, have %d groups in %s", n, c)
+	}
+
+	values, err := c.ParseTyped("10.0.0.1 GET 200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, map[string]interface{}{"source.ip": "10.0.0.1", "code": 200}) {
+		t.Fatalf("unexpected result %v", values)
+	}
+	if ok, _ := c.Match("10.0.0.1 - 200"); !ok {
+		t.Fatal("the expression should still match")
+	}
+
+	// the selection survives reloads
+	if err := g.ReloadPatterns(); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := g.CompileFields(`%{IP:[source][ip]} (%{WORD:verb}|-) %{INT:code:int}`, "code", "source.ip")
+	if again.String() != c.String() {
+		t.Fatalf("expected %s, have %s", c, again)
+	}
+}
+
+func TestParseFieldsBacktrackEngine(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, Engine: BacktrackEngine{}})
+	values, err := g.ParseFields(`%{WORD:a}(?= )\s%{WORD:b}`, "x y", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, map[string]string{"b": "y"}) {
+		t.Fatalf("unexpected result %v", values)
+	}
+}
+
+func TestFieldsKey(t *testing.T) {
+	key, fields := splitFieldsKey(fieldsKey("%{X}", []string{"a", "b"}))
+	if key != "%{X}" || !reflect.DeepEqual(fields, []string{"a", "b"}) {
+		t.Fatalf("unexpected key %q and fields %v", key, fields)
+	}
+	key, fields = splitFieldsKey(fieldsKey("%{X}", []string{}))
+	if key != "%{X}" || fields == nil || len(fields) != 0 {
+		t.Fatalf("unexpected key %q and fields %v", key, fields)
+	}
+	if key, fields = splitFieldsKey(fieldsKey("%{X}", nil)); key != "%{X}" || fields != nil {
+		t.Fatalf("unexpected key %q and fields %v", key, fields)
+	}
+}
+
+// unminimised compiles pattern as NamedCapturesOnly did before the groups
+// feeding no field were stripped.
+func unminimised(t testing.TB, g *Grok, pattern string) *gRegexp {
+	p, err := g.denormalizePattern("", pattern, g.patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := g.compileExpression(p.expression, p.typeInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr.defaults, gr.inferred, gr.names = p.defaults, p.inferred, p.names
+	return gr
+}
+
+func TestNamedCapturesOnlyMinimisation(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	for pattern, text := range map[string]string{
+		"%{COMMONAPACHELOG}":                  apacheLine,
+		"%{COMBINEDAPACHELOG}":                apacheLine + ` "-" "Mozilla/5.0"`,
+		"%{SYSLOGBASE} %{GREEDYDATA:message}": "Jan  1 06:25:43 mailserver14 postfix/cleanup[21403]: message-id=<x@y>",
+		"%{IPV6:ip} %{HOSTNAME}":              "2001:db8::ff00:42:8329 example.com",
+		`%{YEAR:y}-(%{INT:n}|x)`:              "2024-x",
+	} {
+		gr, err := g.compile(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reference := unminimised(t, g, pattern)
+		if gr.numSubexp() >= reference.numSubexp() {
+			t.Fatalf("%s: %d groups, no fewer than %d", pattern, gr.numSubexp(), reference.numSubexp())
+		}
+
+		values, err := g.compiledParse(gr, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := g.compiledParse(reference, text)
+		if len(values) == 0 || !reflect.DeepEqual(values, expected) {
+			t.Fatalf("%s: expected %v, have %v", pattern, expected, values)
+		}
+	}
+}
+
+func BenchmarkNamedCapturesOnly(b *testing.B) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	pattern := "%{COMBINEDAPACHELOG}"
+	text := apacheLine + ` "-" "Mozilla/5.0"`
+	minimised, _ := g.compile(pattern)
+
+	for _, bench := range []struct {
+		name string
+		gr   *gRegexp
+	}{
+		{"minimised", minimised},
+		{"unminimised", unminimised(b, g, pattern)},
+	} {
+		gr := bench.gr
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				g.compiledParse(gr, text)
+			}
+		})
+	}
+}
+
+func BenchmarkParseFields(b *testing.B) {
+	g, _ := NewWithConfig(&Config{})
+	text := apacheLine + ` "-" "Mozilla/5.0"`
+	b.Run("all", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			g.Parse("%{COMBINEDAPACHELOG}", text)
+		}
+	})
+	b.Run("selected", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			g.ParseFields("%{COMBINEDAPACHELOG}", text, "clientip", "response")
+		}
+	})
+}
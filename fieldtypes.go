@@ -0,0 +1,74 @@
+package grok
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ReadFieldTypes reads field types in the pattern file syntax: each line that
+// is neither empty nor a comment holds a semantic name and its type, int,
+// float or string, separated by whitespace.
+func ReadFieldTypes(r io.Reader) (map[string]string, error) {
+	return readFieldTypes(r, "")
+}
+
+func readFieldTypes(r io.Reader, file string) (map[string]string, error) {
+	defs, err := readPatterns(r, file)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(defs))
+	for _, def := range defs {
+		if !validType(def.expression) {
+			return nil, fmt.Errorf("%s: unknown type %q for field %s", def.source, def.expression, def.name)
+		}
+		types[def.name] = def.expression
+	}
+	return types, nil
+}
+
+func validType(typ string) bool {
+	return typ == "int" || typ == "float" || typ == "string"
+}
+
+// loadFieldTypes gathers the types of Config.FieldTypesFile and
+// Config.FieldTypes, the latter taking precedence.
+func (g *Grok) loadFieldTypes() error {
+	types := map[string]string{}
+	if g.config.FieldTypesFile != "" {
+		f, err := os.Open(g.config.FieldTypesFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if types, err = readFieldTypes(f, g.config.FieldTypesFile); err != nil {
+			return err
+		}
+	}
+	for name, typ := range g.config.FieldTypes {
+		if !validType(typ) {
+			return fmt.Errorf("unknown type %q for field %s", typ, name)
+		}
+		types[name] = typ
+	}
+	g.fieldTypes = types
+	return nil
+}
+
+// checkFieldTypes rejects the types declared in an expression that conflict
+// with the field types. It must be called with patternsGuard held.
+func (g *Grok) checkFieldTypes(ti semanticTypes) error {
+	var names []string
+	for name, typ := range ti {
+		if fieldType, ok := g.fieldTypes[name]; ok && fieldType != typ {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return fmt.Errorf("field %s declared %s, its field type is %s", names[0], ti[names[0]], g.fieldTypes[names[0]])
+}
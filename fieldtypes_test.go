@@ -0,0 +1,88 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFieldTypes(t *testing.T) {
+	g, err := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		InferTypes:        true,
+		FieldTypes:        map[string]string{"bytes": "int", "response": "string", "duration": "float"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+	captures, err := g.ParseTyped("%{COMMONAPACHELOG}", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// field types take precedence over inference
+	if captures["bytes"] != 207 || captures["response"] != "404" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	captures, _ = g.ParseTyped(`%{NUMBER:duration}ms`, "12ms")
+	if captures["duration"] != 12.0 {
+		t.Fatalf("duration should be 12.0 have %#v", captures["duration"])
+	}
+
+	// a declaration matching the field type is accepted
+	if _, err := g.ParseTyped(`%{NUMBER:bytes:int}`, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Compile(`%{NUMBER:bytes:float}`); err == nil || !strings.Contains(err.Error(), "bytes") {
+		t.Fatalf("conflicting declarations should be rejected, have %v", err)
+	}
+	if _, err := g.Compile(`%{NUMBER:bytes:string}`); err == nil || !strings.Contains(err.Error(), "bytes") {
+		t.Fatalf("conflicting string declarations should be rejected, have %v", err)
+	}
+	// an explicit string declaration takes precedence over inference
+	captures, _ = g.ParseTyped(`%{INT:count:string}`, "12")
+	if captures["count"] != "12" {
+		t.Fatalf("count should be '12' have %#v", captures["count"])
+	}
+	g.AddPattern("SIZE", `%{NUMBER:bytes:float}`)
+	if _, err := g.Compile(`%{SIZE}`); err == nil {
+		t.Fatal("conflicting declarations of patterns should be rejected")
+	}
+}
+
+func TestFieldTypesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writePatternFile(t, dir, "types", "# shared schema\nbytes int\nlatency\tfloat\n")
+
+	g, err := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		FieldTypesFile:    path,
+		FieldTypes:        map[string]string{"latency": "string"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	captures, _ := g.ParseTyped(`%{INT:bytes} %{NUMBER:latency}`, "12 0.5")
+	if captures["bytes"] != 12 || captures["latency"] != "0.5" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	path = writePatternFile(t, dir, "bad", "bytes integer\n")
+	if _, err := NewWithConfig(&Config{FieldTypesFile: path}); err == nil || !strings.Contains(err.Error(), "bad:1") {
+		t.Fatalf("unknown types should be located, have %v", err)
+	}
+	if _, err := NewWithConfig(&Config{FieldTypes: map[string]string{"x": "bool"}}); err == nil {
+		t.Fatal("unknown types should be rejected")
+	}
+}
+
+func TestConflictingDeclarations(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	if _, err := g.Compile(`%{INT:n:int} %{NUMBER:n:float}`); err == nil {
+		t.Fatal("conflicting declarations should be rejected")
+	}
+	if _, err := g.Compile(`%{INT:n:int} %{INT:n:int}`); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/vjeantet/grok
 
-go 1.15
+go 1.16
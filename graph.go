@@ -1,5 +1,20 @@
 package grok
 
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Formats supported by WriteGraph.
+const (
+	GraphDOT  = "dot"
+	GraphJSON = "json"
+)
+
 type graph map[string][]string
 
 func reverseList(s []string) (r []string) {
@@ -56,3 +71,73 @@ func sortGraph(g graph) (order, cyclic []string) {
 	}
 	return L, nil
 }
+
+// closure returns the subgraph of g reachable from roots.
+func (g graph) closure(roots []string) graph {
+	sub := graph{}
+	var visit func(string)
+	visit = func(n string) {
+		if _, ok := sub[n]; ok {
+			return
+		}
+		sub[n] = g[n]
+		for _, m := range g[n] {
+			visit(m)
+		}
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	return sub
+}
+
+// WriteGraph writes the dependency graph of the loaded patterns to w, as
+// Graphviz DOT or JSON according to format. When roots are given, only the
+// patterns they reference, directly or not, are written.
+func (g *Grok) WriteGraph(w io.Writer, format string, roots ...string) error {
+	g.patternsGuard.RLock()
+	deps := graph{}
+	for name := range g.patterns {
+		deps[name] = uniqueSorted(g.dependencies[name])
+	}
+	g.patternsGuard.RUnlock()
+
+	for _, root := range roots {
+		if _, ok := deps[root]; !ok {
+			return fmt.Errorf("no pattern found for %%{%s}", root)
+		}
+	}
+	if len(roots) > 0 {
+		deps = deps.closure(roots)
+	}
+
+	switch format {
+	case GraphDOT:
+		return writeDOT(w, deps)
+	case GraphJSON:
+		return json.NewEncoder(w).Encode(deps)
+	default:
+		return fmt.Errorf("unknown graph format %q", format)
+	}
+}
+
+func writeDOT(w io.Writer, g graph) error {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph grok {")
+	for _, name := range names {
+		fmt.Fprintf(bw, "\t%s;\n", strconv.Quote(name))
+	}
+	for _, name := range names {
+		for _, dep := range g[name] {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", strconv.Quote(name), strconv.Quote(dep))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -1,6 +1,11 @@
 package grok
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func TestReverseList(t *testing.T) {
 	var array = []string{"A", "B", "C", "D"}
@@ -89,3 +94,60 @@ func sliceEquals(a, b []string) bool {
 
 	return true
 }
+
+func TestWriteGraphDOT(t *testing.T) {
+	g, _ := NewWithConfig(&Config{SkipDefaultPatterns: true})
+	g.AddPatternsFromMap(map[string]string{
+		"NO3":   `\d{3}`,
+		"NO6":   "%{NO3}%{NO3}",
+		"OTHER": `\w+`,
+	})
+
+	var buf bytes.Buffer
+	if err := g.WriteGraph(&buf, GraphDOT); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph grok {
+	"NO3";
+	"NO6";
+	"OTHER";
+	"NO6" -> "NO3";
+}
+`
+	if buf.String() != expected {
+		t.Fatalf("DOT graph is\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteGraphJSONClosure(t *testing.T) {
+	g, _ := New()
+
+	var buf bytes.Buffer
+	if err := g.WriteGraph(&buf, GraphJSON, "COMMONAPACHELOG"); err != nil {
+		t.Fatal(err)
+	}
+	var deps map[string][]string
+	if err := json.Unmarshal(buf.Bytes(), &deps); err != nil {
+		t.Fatal(err)
+	}
+	if !sliceEquals(deps["IPORHOST"], []string{"HOSTNAME", "IP"}) {
+		t.Fatalf("IPORHOST should depend on [HOSTNAME IP], have %v", deps["IPORHOST"])
+	}
+	if _, ok := deps["HOUR"]; !ok {
+		t.Fatal("HOUR is referenced by COMMONAPACHELOG and should be part of the graph")
+	}
+	if _, ok := deps["COMBINEDAPACHELOG"]; ok {
+		t.Fatal("COMBINEDAPACHELOG is not referenced by COMMONAPACHELOG and should not be part of the graph")
+	}
+}
+
+func TestWriteGraphErrors(t *testing.T) {
+	g, _ := New()
+	var buf bytes.Buffer
+	if err := g.WriteGraph(&buf, "svg"); err == nil || !strings.Contains(err.Error(), "svg") {
+		t.Fatalf("WriteGraph should reject unknown formats, have %v", err)
+	}
+	if err := g.WriteGraph(&buf, GraphDOT, "UNKNOWN"); err == nil {
+		t.Fatal("WriteGraph should return an error for an unknown root")
+	}
+}
@@ -3,6 +3,7 @@ package grok
 import (
 	"bufio"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,8 +15,8 @@ import (
 )
 
 var (
-	valid  = regexp.MustCompile(`^\w+([-.]\w+)*(:(([-.()\w]+)|(\[\w+\])+)(:(string|float|int))?)?$`)
-	normal = regexp.MustCompile(`%{([\w-.]+(?::[\w-.()\[\]]+(?::[\w-.()]+)?)?)}`)
+	valid  = regexp.MustCompile(`^\w+([-.]\w+)*(\([-.,()\w]+\))?(:(([-.()\w]+)|(\[\w+\])+)(:(string|float|int))?(=[^{}|:]*)?)?(\|\w+)*$`)
+	normal = regexp.MustCompile(`%{([\w-.]+(?:\([\w-.,()]+\))?(?::[\w-.()\[\]]+(?::[\w-.()]+)?(?:=[^{}|:]*)?)?(?:\|\w+)*)}`)
 	nested = regexp.MustCompile(`\[(\w+)\]`)
 )
 
@@ -24,35 +25,120 @@ type Config struct {
 	NamedCapturesOnly   bool
 	SkipDefaultPatterns bool
 	RemoveEmptyValues   bool
-	PatternsDir         []string
-	Patterns            map[string]string
+	// PatternsDir lists directories, files or glob expressions of pattern
+	// files loaded by NewWithConfig, see AddPatternsFromPath.
+	PatternsDir []string
+	Patterns    map[string]string
+	// FieldTypes assigns types to the captures of semantic names, for the
+	// references that do not declare one. Expressions declaring another type
+	// for these names are rejected.
+	FieldTypes map[string]string
+	// FieldTypesFile names a file of field types read by NewWithConfig, see
+	// ReadFieldTypes. FieldTypes takes precedence over it.
+	FieldTypesFile string
+	// InferTypes converts the captures without a declared type with ParseTyped,
+	// according to the pattern they are matched with: integers for INT,
+	// POSINT and NONNEGINT, integers or floats for NUMBER, time.Time for
+	// timestamps such as HTTPDATE. Values that cannot be converted are kept.
+	InferTypes bool
+	// ECSCompatibility selects the field names of the default patterns:
+	// ECSDisabled, the default, keeps the legacy names and ECSV1 renames them
+	// after the Elastic Common Schema.
+	ECSCompatibility string
+	// ECSPatternsDir renames the fields of the patterns of PatternsDir as
+	// well when they are defined as in the pattern files shipped in the
+	// patterns directory. Other patterns keep their field names.
+	ECSPatternsDir bool
+	// MaxCompiledPatterns bounds the number of compiled expressions kept in
+	// cache, the least recently used one is evicted first. Zero means no limit.
+	MaxCompiledPatterns int
+	// Engine compiles the expanded expressions, RE2Engine when nil.
+	Engine Engine
+	// DuplicatePatterns tells how patterns defined more than once in pattern
+	// files are handled.
+	DuplicatePatterns DuplicatePolicy
+	// NestedFieldSyntax tells which semantic names designate nested fields,
+	// [a][b] style names by default.
+	NestedFieldSyntax NestedFieldSyntax
+	// FlattenNested names nested fields with their dotted path, e.g.
+	// source.ip for [source][ip], instead of nesting them.
+	FlattenNested bool
+	// DuplicateFields tells which value a semantic name captured more than
+	// once in an expression gets with Parse and ParseTyped.
+	DuplicateFields DuplicateFieldPolicy
+	// Defaults maps semantic names to the value their fields get when they
+	// are empty or did not participate in the match, after DuplicateFields
+	// merged their captures. A default set in the expression, as in
+	// %{NUMBER:bytes:int=0}, takes precedence.
+	Defaults map[string]string
+	// Rules maps pattern names to the rules validating the results of
+	// ParseTyped for the expressions referencing them, in addition to the
+	// rules annotating the patterns in pattern files. Only texts matching the
+	// expression are validated, a required field is not reported when the
+	// text does not match, nor when the reference of its pattern does not
+	// take part in the match, as the other branches of an alternation.
+	Rules map[string][]Rule
+	// Modifiers registers the modifiers applied with the %{SYNTAX:SEMANTIC|name}
+	// syntax, in addition to the built-in ones, see AddModifier.
+	Modifiers map[string]Modifier
+	// Warn is called with non fatal problems, such as duplicate pattern
+	// definitions. They are written to the standard logger when Warn is nil.
+	Warn func(error)
 }
 
 // Grok object us used to load patterns and deconstruct strings using those
 // patterns.
 type Grok struct {
 	rawPattern       map[string]string
+	dependencies     graph
+	sources          map[string]Source
+	configured       bool
+	addedPatterns    map[string]string // added after the configuration was loaded
+	addedSources     map[string]Source
+	generation       int // incremented each time the patterns are reloaded
 	config           *Config
-	aliases          map[string]string
-	compiledPatterns map[string]*gRegexp
+	compiledPatterns *patternCache
 	patterns         map[string]*gPattern
+	fieldTypes       map[string]string
+	rules            map[string][]rule // rules annotating the pattern files
+	addedRules       map[string][]rule
+	configRules      map[string][]rule
+	modifiers        map[string]Modifier
 	patternsGuard    *sync.RWMutex
 	compiledGuard    *sync.RWMutex
-	aliasesGuard     *sync.RWMutex
 }
 
 type gPattern struct {
 	expression string
 	typeInfo   semanticTypes
+	modifiers  semanticModifiers
+	defaults   map[string]string
+	inferred   semanticTypes // types inferred from the syntax of references
+	names      captureNames
+	ruleGroups ruleGroups
+	kind       string // type inferred for the pattern, see InferTypes
+	macro      *macro // set for parameterized patterns, expanded when called
+	err        error  // raised when the pattern is used, see CompatError
 }
 
 type gRegexp struct {
-	regexp   *regexp.Regexp
-	typeInfo semanticTypes
+	regexp     Regexp
+	typeInfo   semanticTypes
+	modifiers  map[string][]Modifier
+	defaults   map[string]string
+	inferred   semanticTypes
+	fieldTypes map[string]string
+	rules      map[string][]rule // rules of the groups of ruleGroups
+	fields     map[string]bool   // fields kept in the results, all when nil
+	names      captureNames
 }
 
 type semanticTypes map[string]string
 
+// semanticModifiers maps semantic names to the modifiers applied to their
+// values.
+type semanticModifiers map[string][]string
+
 // New returns a Grok object.
 func New() (*Grok, error) {
 	return NewWithConfig(&Config{})
@@ -61,68 +147,141 @@ func New() (*Grok, error) {
 // NewWithConfig returns a Grok object that is configured to behave according
 // to the supplied Config structure.
 func NewWithConfig(config *Config) (*Grok, error) {
-	g := &Grok{
+	g := newGrok(config)
+	if err := g.loadConfig(); err != nil {
+		return nil, err
+	}
+	g.configured = true
+
+	return g, nil
+}
+
+func newGrok(config *Config) *Grok {
+	return &Grok{
 		config:           config,
-		aliases:          map[string]string{},
-		compiledPatterns: map[string]*gRegexp{},
+		compiledPatterns: newPatternCache(config.MaxCompiledPatterns),
 		patterns:         map[string]*gPattern{},
 		rawPattern:       map[string]string{},
+		sources:          map[string]Source{},
+		addedPatterns:    map[string]string{},
+		addedSources:     map[string]Source{},
+		rules:            map[string][]rule{},
+		addedRules:       map[string][]rule{},
+		modifiers:        newModifiers(config.Modifiers),
 		patternsGuard:    new(sync.RWMutex),
 		compiledGuard:    new(sync.RWMutex),
-		aliasesGuard:     new(sync.RWMutex),
 	}
+}
+
+// loadConfig loads the patterns designated by the configuration.
+func (g *Grok) loadConfig() error {
+	switch g.config.ECSCompatibility {
+	case "", ECSDisabled, ECSV1:
+	default:
+		return fmt.Errorf("unsupported ECS compatibility %q", g.config.ECSCompatibility)
+	}
+	if err := g.loadFieldTypes(); err != nil {
+		return err
+	}
+	rules, err := newRules(g.config.Rules)
+	if err != nil {
+		return err
+	}
+	g.configRules = rules
 
-	if !config.SkipDefaultPatterns {
-		err := g.AddPatternsFromMap(patterns)
+	if !g.config.SkipDefaultPatterns {
+		err := g.AddPatternsFromMap(g.ecsPatterns(patterns))
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	if len(config.PatternsDir) > 0 {
-		for _, path := range config.PatternsDir {
+	if len(g.config.PatternsDir) > 0 {
+		for _, path := range g.config.PatternsDir {
 			err := g.AddPatternsFromPath(path)
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 
 	}
 
-	if err := g.AddPatternsFromMap(config.Patterns); err != nil {
-		return nil, err
-	}
-
-	return g, nil
+	return g.AddPatternsFromMap(g.config.Patterns)
 }
 
 // AddPattern adds a new pattern to the list of loaded patterns.
 func (g *Grok) addPattern(name, pattern string) error {
-	dnPattern, ti, err := g.denormalizePattern(pattern, g.patterns)
+	return g.storePattern(g.patterns, name, pattern)
+}
+
+// storePattern expands pattern with the patterns of target and stores it
+// there under name.
+func (g *Grok) storePattern(target map[string]*gPattern, name, pattern string) error {
+	p, err := g.denormalizePattern(name, pattern, target)
+	var compatErr *CompatError
+	if errors.As(err, &compatErr) {
+		// patterns files may hold patterns out of reach of the regexp
+		// engine, they only fail when used
+		target[name] = &gPattern{err: err}
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	g.patterns[name] = &gPattern{expression: dnPattern, typeInfo: ti}
+	target[name] = p
 	return nil
 }
 
 // AddPattern adds a named pattern to grok
 func (g *Grok) AddPattern(name, pattern string) error {
-	g.patternsGuard.Lock()
-	defer g.patternsGuard.Unlock()
-
-	g.rawPattern[name] = pattern
-	return g.buildPatterns()
+	return g.addRawPatterns(map[string]string{name: pattern}, nil, nil)
 }
 
 // AddPatternsFromMap loads a map of named patterns
 func (g *Grok) AddPatternsFromMap(m map[string]string) error {
+	return g.addRawPatterns(m, nil, nil)
+}
+
+// addRawPatterns adds the patterns of m, along with the location and the
+// rules of the ones read from pattern files keyed on the pattern names, and
+// rebuilds the loaded patterns. Macro signatures such as QUOTED(X) are valid
+// keys of m.
+func (g *Grok) addRawPatterns(m map[string]string, sources map[string]Source, rules map[string][]rule) error {
 	g.patternsGuard.Lock()
 	defer g.patternsGuard.Unlock()
 
-	for name, pattern := range m {
-		g.rawPattern[name] = pattern
+	for key := range m {
+		if _, _, err := patternName(key); err != nil {
+			return err
+		}
+	}
+	for key, pattern := range m {
+		name, _, _ := patternName(key)
+		setRaw(g.rawPattern, key, pattern)
+		if source, ok := sources[name]; ok {
+			g.sources[name] = source
+		} else {
+			delete(g.sources, name)
+		}
+		if r, ok := rules[name]; ok {
+			g.rules[name] = r
+		} else {
+			delete(g.rules, name)
+		}
+		if g.configured {
+			setRaw(g.addedPatterns, key, pattern)
+			if source, ok := sources[name]; ok {
+				g.addedSources[name] = source
+			} else {
+				delete(g.addedSources, name)
+			}
+			if r, ok := rules[name]; ok {
+				g.addedRules[name] = r
+			} else {
+				delete(g.addedRules, name)
+			}
+		}
 	}
 	return g.buildPatterns()
 }
@@ -130,71 +289,132 @@ func (g *Grok) AddPatternsFromMap(m map[string]string) error {
 // AddPatternsFromMap adds new patterns from the specified map to the list of
 // loaded patterns.
 func (g *Grok) addPatternsFromMap(m map[string]string) error {
-	patternDeps := graph{}
+	deps, err := g.expandPatterns(g.patterns, m, true)
+	if deps != nil {
+		g.dependencies = deps
+	}
+	return err
+}
+
+// expandPatterns stores the patterns of m in target, in dependency order, and
+// returns their dependency graph, nil when a reference is missing. Errors are
+// located in the pattern files when loaded is true.
+func (g *Grok) expandPatterns(target map[string]*gPattern, m map[string]string, loaded bool) (graph, error) {
+	located := func(name string, err error) error {
+		if loaded {
+			return g.located(name, err)
+		}
+		return err
+	}
+
+	bodies := make(map[string]string, len(m))
+	params := map[string][]string{}
 	for k, v := range m {
+		name, ps, err := patternName(k)
+		if err != nil {
+			return nil, located(k, err)
+		}
+		bodies[name] = v
+		if ps != nil {
+			params[name] = ps
+		}
+	}
+
+	patternDeps := graph{}
+	for k, v := range bodies {
+		refs, err := references(v)
+		if err != nil {
+			return nil, located(k, err)
+		}
+		isParam := map[string]bool{}
+		for _, param := range params[k] {
+			isParam[param] = true
+		}
 		var keys []string
-		for _, key := range normal.FindAllStringSubmatch(v, -1) {
-			if !valid.MatchString(key[1]) {
-				return fmt.Errorf("invalid pattern %%{%s}", key[1])
+		for _, ref := range refs {
+			callee, _, err := parseCall(ref.syntax)
+			if err != nil {
+				return nil, located(k, err)
 			}
-			names := strings.Split(key[1], ":")
-			syntax := names[0]
-			if g.patterns[syntax] == nil {
-				if _, ok := m[syntax]; !ok {
-					return fmt.Errorf("no pattern found for %%{%s}", syntax)
+			if isParam[callee] && callee != ref.syntax {
+				return nil, located(k, fmt.Errorf("macro %q cannot call its parameter %q", k, callee))
+			}
+			for _, name := range calledNames(ref.syntax) {
+				if isParam[name] {
+					continue
+				}
+				if _, ok := bodies[name]; ok {
+					keys = append(keys, name)
+				} else if target[name] == nil {
+					return nil, located(k, fmt.Errorf("no pattern found for %%{%s}", name))
 				}
 			}
-			keys = append(keys, syntax)
 		}
 		patternDeps[k] = keys
 	}
-	order, _ := sortGraph(patternDeps)
+	order, cyclic := sortGraph(patternDeps)
+	if cyclic != nil {
+		cycle := append(reverseList(cyclic), cyclic[len(cyclic)-1])
+		return nil, located(cyclic[0], fmt.Errorf("cyclic pattern definitions %s", strings.Join(cycle, " -> ")))
+	}
 	for _, key := range reverseList(order) {
-		err := g.addPattern(key, m[key])
+		if ps, ok := params[key]; ok {
+			target[key] = &gPattern{macro: &macro{params: ps, body: bodies[key]}}
+			continue
+		}
+		err := g.storePattern(target, key, bodies[key])
 		if err != nil {
-			return fmt.Errorf("cannot add pattern %q: %v", key, err)
+			return patternDeps, located(key, fmt.Errorf("cannot add pattern %q: %v", key, err))
 		}
 	}
 
-	return nil
+	return patternDeps, nil
+}
+
+// located prefixes err with the location of the named pattern when it was
+// read from a pattern file.
+func (g *Grok) located(name string, err error) error {
+	if source, ok := g.sources[name]; ok {
+		return fmt.Errorf("%s: %v", source, err)
+	}
+	return err
 }
 
 // AddPatternsFromPath adds new patterns from the files in the specified
-// directory to the list of loaded patterns.
+// directory to the list of loaded patterns. path may also be a single file or
+// a glob expression, where a "**" element matches any number of directories.
 func (g *Grok) AddPatternsFromPath(path string) error {
-	if fi, err := os.Stat(path); err == nil {
-		if fi.IsDir() {
-			path = path + "/*"
-		}
-	} else {
-		return fmt.Errorf("invalid path : %s", path)
+	base, pattern, isGlob, err := resolvePatternsPath(path)
+	if err != nil {
+		return err
 	}
 
-	// only one error can be raised, when pattern is malformed
-	// pattern is hard-coded "/*" so we ignore err
-	files, _ := filepath.Glob(path)
-
-	var filePatterns = map[string]string{}
-	for _, fileName := range files {
-		file, err := os.Open(fileName)
-		if err != nil {
-			return err
+	err = g.addPatternsFromFS(os.DirFS(base), pattern, func(name string) string {
+		return filepath.Join(base, filepath.FromSlash(name))
+	})
+	if err == errNoPatternFiles {
+		if isGlob {
+			return fmt.Errorf("invalid path : %s", path)
 		}
+		return nil
+	}
+	return err
+}
 
-		scanner := bufio.NewScanner(bufio.NewReader(file))
-
-		for scanner.Scan() {
-			l := scanner.Text()
-			if len(l) > 0 && l[0] != '#' {
-				names := strings.SplitN(l, " ", 2)
-				filePatterns[names[0]] = names[1]
-			}
+// resolvePatternsPath splits a path given to AddPatternsFromPath into a
+// directory and a glob of pattern files relative to it.
+func resolvePatternsPath(path string) (base, pattern string, isGlob bool, err error) {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.IsDir() {
+			return path, "*", false, nil
 		}
-
-		_ = file.Close()
+		return filepath.Dir(path), filepath.Base(path), false, nil
 	}
-
-	return g.AddPatternsFromMap(filePatterns)
+	if hasMeta(path) {
+		base, pattern = splitGlob(path)
+		return base, pattern, true, nil
+	}
+	return "", "", false, fmt.Errorf("invalid path : %s", path)
 }
 
 // Match returns true if the specified text matches the pattern.
@@ -204,6 +424,16 @@ func (g *Grok) Match(pattern, text string) (bool, error) {
 		return false, err
 	}
 
+	return g.compiledMatch(gr, text)
+}
+
+// compiledMatch returns true if the specified text matches gr.
+func (g *Grok) compiledMatch(gr *gRegexp, text string) (bool, error) {
+	if _, ok := gr.regexp.(fallibleRegexp); ok {
+		match, err := gr.submatch(text)
+		return match != nil, err
+	}
+
 	if ok := gr.regexp.MatchString(text); !ok {
 		return false, nil
 	}
@@ -213,20 +443,11 @@ func (g *Grok) Match(pattern, text string) (bool, error) {
 
 // compiledParse parses the specified text and returns a map with the results.
 func (g *Grok) compiledParse(gr *gRegexp, text string) (map[string]string, error) {
-	captures := make(map[string]string, gr.regexp.NumSubexp())
-	if match := gr.regexp.FindStringSubmatch(text); len(match) > 0 {
-		for i, name := range gr.regexp.SubexpNames() {
-			if name != "" {
-				if g.config.RemoveEmptyValues && match[i] == "" {
-					continue
-				}
-				name = g.nameToAlias(name)
-				captures[name] = match[i]
-			}
-		}
+	captures, err := g.compiledParseOrdered(gr, text)
+	if err != nil {
+		return nil, err
 	}
-
-	return captures, nil
+	return captures.Map(), nil
 }
 
 // Parse the specified text and return a map with the results.
@@ -241,61 +462,75 @@ func (g *Grok) Parse(pattern, text string) (map[string]string, error) {
 
 // ParseTyped returns a interface{} map with typed captured fields based on provided pattern over the text.
 // Is able to return nested map[string]interface{} maps when %{PATTERN:[nested][field]} syntax is used.
+// When the fields break the rules of the patterns, see Config.Rules, the map
+// is returned along with a *ValidationError listing every violation. A text
+// that does not match returns an empty map and no error.
 func (g *Grok) ParseTyped(pattern string, text string) (map[string]interface{}, error) {
 	gr, err := g.compile(pattern)
 	if err != nil {
 		return nil, err
 	}
-	match := gr.regexp.FindStringSubmatch(text)
-	captures := make(map[string]interface{}, gr.regexp.NumSubexp())
-	if len(match) > 0 {
-		for i, segmentName := range gr.regexp.SubexpNames() {
-			if len(segmentName) != 0 {
-				if g.config.RemoveEmptyValues == true && match[i] == "" {
-					continue
-				}
-				name := g.nameToAlias(segmentName)
-				nested_path := []string{}
-				nested_names := nested.FindAllStringSubmatch(name, -1)
-
-				if nested_names != nil {
-					for _, element := range nested_names {
-						nested_path = append(nested_path, element[1])
-					}
-				}
 
-				if segmentType, ok := gr.typeInfo[name]; ok {
-					switch segmentType {
-					case "int":
-						value, _ := strconv.Atoi(match[i])
-						if len(nested_path) > 0 {
-							addNested(captures, nested_path, value)
-						} else {
-							captures[name] = value
-						}
-					case "float":
-						value, _ := strconv.ParseFloat(match[i], 64)
-						if len(nested_path) > 0 {
-							addNested(captures, nested_path, value)
-						} else {
-							captures[name] = value
-						}
-					default:
-						return nil, fmt.Errorf("ERROR the value %s cannot be converted to %s", match[i], segmentType)
-					}
-				} else {
-					if len(nested_path) > 0 {
-						addNested(captures, nested_path, match[i])
-					} else {
-						captures[name] = match[i]
-					}
-				}
-			}
+	return g.compiledParseTyped(gr, text)
+}
+
+// compiledParseTyped parses the specified text and returns a map with the
+// typed results.
+func (g *Grok) compiledParseTyped(gr *gRegexp, text string) (map[string]interface{}, error) {
+	captured, rules, err := g.captures(gr, text)
+	if err != nil {
+		return nil, err
+	}
+	return g.typedMap(gr, captured, rules)
+}
+
+// typedMap returns the typed fields of the captures of gr as a map, validated
+// with rules.
+func (g *Grok) typedMap(gr *gRegexp, captured []capture, rules []rule) (map[string]interface{}, error) {
+	captures, err := g.typedCaptures(gr, captured)
+	if err != nil {
+		return nil, err
+	}
+	m, err := captures.nested(true)
+	if err != nil || len(rules) == 0 {
+		return m, err
+	}
+	return m, g.validate(captured, rules)
+}
 
+// typedValue converts a value of the semantic name to its declared type, or
+// else to its type of Config.FieldTypes, or else to its inferred one with
+// Config.InferTypes.
+func (g *Grok) typedValue(gr *gRegexp, semantic, value string) (interface{}, error) {
+	if typ, ok := gr.typeInfo[semantic]; ok {
+		return convert(value, typ)
+	}
+	if typ, ok := gr.fieldTypes[semantic]; ok {
+		if typ == "string" {
+			return value, nil
 		}
+		return convert(value, typ)
+	}
+	if kind, ok := gr.inferred[semantic]; ok && g.config.InferTypes {
+		return convertInferred(value, kind), nil
 	}
+	return value, nil
+}
 
-	return captures, nil
+// convert returns value converted to the type declared for its capture.
+func convert(value, segmentType string) (interface{}, error) {
+	switch segmentType {
+	case "", "string":
+		return value, nil
+	case "int":
+		v, _ := strconv.Atoi(value)
+		return v, nil
+	case "float":
+		v, _ := strconv.ParseFloat(value, 64)
+		return v, nil
+	default:
+		return nil, fmt.Errorf("ERROR the value %s cannot be converted to %s", value, segmentType)
+	}
 }
 
 // ParseToMultiMap parses the specified text and returns a map with the
@@ -307,17 +542,19 @@ func (g *Grok) ParseToMultiMap(pattern, text string) (map[string][]string, error
 		return nil, err
 	}
 
-	captures := make(map[string][]string, gr.regexp.NumSubexp())
-	if match := gr.regexp.FindStringSubmatch(text); len(match) > 0 {
-		for i, name := range gr.regexp.SubexpNames() {
-			if name != "" {
-				if g.config.RemoveEmptyValues == true && match[i] == "" {
-					continue
-				}
-				name = g.nameToAlias(name)
-				captures[name] = append(captures[name], match[i])
-			}
-		}
+	return g.compiledParseToMultiMap(gr, text)
+}
+
+// compiledParseToMultiMap parses the specified text and returns a map with
+// the results stored in string slices.
+func (g *Grok) compiledParseToMultiMap(gr *gRegexp, text string) (map[string][]string, error) {
+	captured, _, err := g.captures(gr, text)
+	if err != nil {
+		return nil, err
+	}
+	captures := make(map[string][]string, len(captured))
+	for _, c := range captured {
+		captures[c.name] = append(captures[c.name], c.value)
 	}
 
 	return captures, nil
@@ -329,39 +566,132 @@ func (g *Grok) buildPatterns() error {
 }
 
 func (g *Grok) compile(pattern string) (*gRegexp, error) {
-	g.compiledGuard.RLock()
-	gr, ok := g.compiledPatterns[pattern]
-	g.compiledGuard.RUnlock()
+	return g.compileWith(pattern, nil)
+}
+
+// compileWith compiles pattern with the temporary definitions defs layered
+// over the loaded patterns.
+func (g *Grok) compileWith(pattern string, defs map[string]string) (*gRegexp, error) {
+	return g.compileFields(pattern, defs, nil)
+}
+
+// compileFields works as compileWith, the results only holding the fields
+// listed in fields unless it is nil.
+func (g *Grok) compileFields(pattern string, defs map[string]string, fields []string) (*gRegexp, error) {
+	key := fieldsKey(cacheKey(pattern, defs), fields)
+	if g.boundedCache() {
+		// a bounded cache updates its recency list on every hit
+		g.compiledGuard.Lock()
+	} else {
+		g.compiledGuard.RLock()
+	}
+	gr, ok := g.compiledPatterns.get(key)
+	if g.boundedCache() {
+		g.compiledGuard.Unlock()
+	} else {
+		g.compiledGuard.RUnlock()
+	}
 
 	if ok {
 		return gr, nil
 	}
 
 	g.patternsGuard.RLock()
-	newPattern, ti, err := g.denormalizePattern(pattern, g.patterns)
+	stored, err := g.layerPatterns(defs)
+	var p *gPattern
+	var modifiers map[string][]Modifier
+	if err == nil {
+		p, err = g.denormalizePattern("", pattern, stored)
+	}
+	if err == nil {
+		err = g.checkFieldTypes(p.typeInfo)
+	}
+	if err == nil {
+		modifiers, err = g.resolveModifiers(p.modifiers)
+	}
+	var rules map[string][]rule
+	if err == nil {
+		rules = g.groupRules(p.ruleGroups)
+	}
+	generation := g.generation
+	fieldTypes := g.fieldTypes // swapped by ReloadPatterns
 	g.patternsGuard.RUnlock()
 	if err != nil {
 		return nil, err
 	}
 
-	compiledRegex, err := regexp.Compile(newPattern)
+	var selected map[string]bool
+	if fields != nil {
+		selected = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			selected[field] = true
+		}
+	}
+	expression := p.expression
+	if _, ok := g.engine().(RE2Engine); ok && (fields != nil || g.config.NamedCapturesOnly) {
+		// groups feeding no field are turned into non-capturing groups, other
+		// engines may not support the syntax of the stripped expression
+		gr := &gRegexp{fields: selected}
+		expression = stripCaptures(expression, func(name string) bool {
+			_, marker := p.ruleGroups[name]
+			return marker || (name != "" && g.selected(gr, p.names.name(name)))
+		})
+	}
+
+	gr, err = g.compileExpression(expression, p.typeInfo)
 	if err != nil {
 		return nil, err
 	}
-	gr = &gRegexp{regexp: compiledRegex, typeInfo: ti}
+	gr.names = p.names
+	gr.fields = selected
+	gr.modifiers = modifiers
+	gr.defaults = p.defaults
+	gr.inferred = p.inferred
+	gr.fieldTypes = fieldTypes
+	gr.rules = rules
 
 	g.compiledGuard.Lock()
-	g.compiledPatterns[pattern] = gr
+	// patterns reloaded since the expansion must not pollute the new cache
+	if generation == g.generation {
+		gr = g.cacheCompiled(key, gr)
+	}
 	g.compiledGuard.Unlock()
 
 	return gr, nil
 }
 
-func (g *Grok) denormalizePattern(pattern string, storedPatterns map[string]*gPattern) (string, semanticTypes, error) {
+// compileExpression compiles an expanded expression.
+func (g *Grok) compileExpression(expression string, ti semanticTypes) (*gRegexp, error) {
+	compiledRegex, err := g.engine().Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return &gRegexp{regexp: compiledRegex, typeInfo: ti}, nil
+}
+
+// cacheCompiled stores gr in the compiled cache and returns the cached
+// expression. It must be called with compiledGuard held.
+func (g *Grok) cacheCompiled(pattern string, gr *gRegexp) *gRegexp {
+	return g.compiledPatterns.add(pattern, gr)
+}
+
+// denormalizePattern expands the references of the pattern with the stored
+// patterns, name being the name of the pattern, empty for a parsed expression.
+func (g *Grok) denormalizePattern(name, pattern string, storedPatterns map[string]*gPattern) (*gPattern, error) {
 	ti := semanticTypes{}
+	modifiers := semanticModifiers{}
+	defaults := map[string]string{}
+	inferred := semanticTypes{}
+	declared := semanticTypes{} // explicit types of the references of pattern
+	names := captureNames{}
+	groups := ruleGroups{}
 	matches := normal.FindAllStringSubmatchIndex(pattern, -1)
 	if len(matches) == 0 {
-		return pattern, ti, nil
+		expression, err := g.translateOniguruma(name, pattern, 0, ti, names)
+		if err != nil {
+			return nil, err
+		}
+		return &gPattern{expression: expression, typeInfo: ti, modifiers: modifiers, defaults: defaults, inferred: inferred, names: names, ruleGroups: groups}, nil
 	}
 
 	var result strings.Builder
@@ -375,36 +705,58 @@ func (g *Grok) denormalizePattern(pattern string, storedPatterns map[string]*gPa
 		submatchEnd := match[3]
 
 		// Extract the matched pattern name (e.g., "WORD:field:int")
-		patternName := pattern[submatchStart:submatchEnd]
+		ref, err := parseReference(pattern[submatchStart:submatchEnd])
+		if err != nil {
+			return nil, err
+		}
 
-		if !valid.MatchString(patternName) {
-			return "", ti, fmt.Errorf("invalid pattern %%{%s}", patternName)
+		alias := ref.syntax
+		if ref.named {
+			alias = names.alias(ref.semantic)
 		}
 
-		names := strings.Split(patternName, ":")
-		syntax, semantic, alias := names[0], names[0], names[0]
-		if len(names) > 1 {
-			semantic = names[1]
-			alias = g.aliasizePatternName(semantic)
+		if prev, ok := declared[ref.semantic]; ok && ref.typ != "" && prev != ref.typ {
+			return nil, fmt.Errorf("conflicting types %s and %s declared for %s", prev, ref.typ, ref.semantic)
+		}
+		if ref.typ != "" {
+			declared[ref.semantic] = ref.typ
 		}
 
-		// Add type cast information only if type set, and not string
-		if len(names) == 3 {
-			if names[2] != "string" {
-				ti[semantic] = names[2]
-			}
+		// explicit string types are recorded as well, they take precedence
+		// over the field types
+		if ref.typ != "" {
+			ti[ref.semantic] = ref.typ
+		}
+		if len(ref.modifiers) > 0 {
+			modifiers[ref.semantic] = ref.modifiers
+		}
+		if ref.hasDefault {
+			defaults[ref.semantic] = ref.defaultValue
 		}
 
-		storedPattern, ok := storedPatterns[syntax]
-		if !ok {
-			return "", ti, fmt.Errorf("no pattern found for %%{%s}", syntax)
+		storedPattern, err := g.callPattern(ref.syntax, storedPatterns)
+		if err != nil {
+			return nil, err
 		}
 
 		// Copy text before this match
-		result.WriteString(pattern[lastEnd:matchStart])
+		text, err := g.translateOniguruma(name, pattern[lastEnd:matchStart], lastEnd, ti, names)
+		if err != nil {
+			return nil, err
+		}
+		result.WriteString(text)
+
+		// references of patterns carrying rules are wrapped in a group
+		// telling whether they took part in the match
+		callee, _, _ := parseCall(ref.syntax)
+		if g.hasRules(callee) {
+			result.WriteString("(?P<")
+			result.WriteString(groups.group(callee))
+			result.WriteString(">")
+		}
 
 		// Build replacement
-		if !g.config.NamedCapturesOnly || (g.config.NamedCapturesOnly && len(names) > 1) {
+		if !g.config.NamedCapturesOnly || (g.config.NamedCapturesOnly && ref.named) {
 			result.WriteString("(?P<")
 			result.WriteString(alias)
 			result.WriteString(">")
@@ -415,6 +767,9 @@ func (g *Grok) denormalizePattern(pattern string, storedPatterns map[string]*gPa
 			result.WriteString(storedPattern.expression)
 			result.WriteString(")")
 		}
+		if g.hasRules(callee) {
+			result.WriteString(")")
+		}
 
 		// Merge type Information
 		for k, v := range storedPattern.typeInfo {
@@ -423,33 +778,71 @@ func (g *Grok) denormalizePattern(pattern string, storedPatterns map[string]*gPa
 				ti[k] = v
 			}
 		}
+		for k, v := range storedPattern.names {
+			names[k] = v
+		}
+		for k, v := range storedPattern.ruleGroups {
+			groups[k] = v
+		}
+		for k, v := range storedPattern.modifiers {
+			if _, ok := modifiers[k]; !ok {
+				modifiers[k] = v
+			}
+		}
+		for k, v := range storedPattern.defaults {
+			if _, ok := defaults[k]; !ok {
+				defaults[k] = v
+			}
+		}
+		if kind := patternKind(ref.syntax, storedPattern); kind != "" && ref.typ == "" {
+			inferred[ref.semantic] = kind
+		}
+		for k, v := range storedPattern.inferred {
+			if _, ok := inferred[k]; !ok {
+				inferred[k] = v
+			}
+		}
 
 		lastEnd = matchEnd
 	}
 
 	// Copy remaining text after last match
-	result.WriteString(pattern[lastEnd:])
-
-	return result.String(), ti, nil
+	text, err := g.translateOniguruma(name, pattern[lastEnd:], lastEnd, ti, names)
+	if err != nil {
+		return nil, err
+	}
+	result.WriteString(text)
+
+	return &gPattern{
+		expression: result.String(),
+		typeInfo:   ti,
+		modifiers:  modifiers,
+		defaults:   defaults,
+		inferred:   inferred,
+		names:      names,
+		ruleGroups: groups,
+		kind:       aliasKind(pattern, storedPatterns),
+	}, nil
 }
 
-func (g *Grok) aliasizePatternName(name string) string {
-	d := []byte(name)
-	alias := fmt.Sprintf("h%x", md5.Sum(d))
-	g.aliasesGuard.Lock()
-	g.aliases[alias] = name
-	g.aliasesGuard.Unlock()
+// captureNames maps the aliases of the named captures of an expression to
+// their semantic names.
+type captureNames map[string]string
+
+// alias returns the alias of the capture named name and records it.
+func (n captureNames) alias(name string) string {
+	alias := fmt.Sprintf("h%x", md5.Sum([]byte(name)))
+	n[alias] = name
 	return alias
 }
 
-func (g *Grok) nameToAlias(name string) string {
-	g.aliasesGuard.RLock()
-	alias, ok := g.aliases[name]
-	g.aliasesGuard.RUnlock()
-	if ok {
-		return alias
+// name returns the semantic name of the capture group, the group name itself
+// when it is not an alias.
+func (n captureNames) name(group string) string {
+	if name, ok := n[group]; ok {
+		return name
 	}
-	return name
+	return group
 }
 
 // ParseStream will match the given pattern on a line by line basis from the reader
@@ -485,6 +878,9 @@ func addNested(n map[string]interface{}, path []string, value interface{}) error
 	//if this is the leaf element of the path
 	//just add it to the map
 	if len(path) == 0 {
+		if _, ismap := n[element].(map[string]interface{}); ismap {
+			return fmt.Errorf("Overwriting the nested fields of key %s", element)
+		}
 		n[element] = value
 		return nil
 	}
@@ -0,0 +1,94 @@
+package grok
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inferredKinds are the types inferred for the captures of the shipped
+// patterns with Config.InferTypes. Patterns that are aliases of these, such
+// as NUMBER for BASE10NUM, get the same type.
+var inferredKinds = map[string]string{
+	"INT":               "int",
+	"POSINT":            "int",
+	"NONNEGINT":         "int",
+	"BASE10NUM":         "number",
+	"HTTPDATE":          "time",
+	"HTTPDERROR_DATE":   "time",
+	"TIMESTAMP_ISO8601": "time",
+	"DATESTAMP_RFC2822": "time",
+}
+
+// timeLayouts are tried in order to convert the captures inferred as time.
+var timeLayouts = []string{
+	"02/Jan/2006:15:04:05 -0700",
+	"Mon Jan 2 15:04:05 2006",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// singleReference matches the expressions made of a single reference, such as
+// (?:%{BASE10NUM}).
+var singleReference = regexp.MustCompile(`^(\(\?:)*%{([^{}]+)}\)*$`)
+
+// patternKind returns the type inferred for the captures of a stored pattern
+// referenced with syntax.
+func patternKind(syntax string, p *gPattern) string {
+	if kind, ok := inferredKinds[syntax]; ok {
+		return kind
+	}
+	return p.kind
+}
+
+// aliasKind returns the type inferred for a pattern whose expression is a
+// single reference, following alias chains, empty otherwise.
+func aliasKind(pattern string, storedPatterns map[string]*gPattern) string {
+	m := singleReference.FindStringSubmatch(pattern)
+	if m == nil || strings.Count(m[0], "(") != strings.Count(m[0], ")") {
+		return ""
+	}
+	ref, err := parseReference(m[2])
+	if err != nil || ref.typ != "" {
+		return ref.typ
+	}
+	if p, ok := storedPatterns[ref.syntax]; ok {
+		return patternKind(ref.syntax, p)
+	}
+	return ""
+}
+
+// convertInferred converts a value to its inferred type, the value is kept
+// as is when it cannot be converted.
+func convertInferred(value, kind string) interface{} {
+	switch kind {
+	case "float":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case "int":
+		if v, err := strconv.Atoi(value); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.Atoi(value); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case "time":
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t
+			}
+		}
+	}
+	return value
+}
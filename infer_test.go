@@ -0,0 +1,59 @@
+package grok
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInferTypes(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, InferTypes: true})
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+
+	captures, err := g.ParseTyped("%{COMMONAPACHELOG}", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["response"] != 404 || captures["bytes"] != 207 || captures["httpversion"] != 1.1 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	timestamp, ok := captures["timestamp"].(time.Time)
+	if !ok || !timestamp.Equal(time.Date(2014, 4, 23, 20, 58, 32, 0, time.UTC)) {
+		t.Fatalf("timestamp should be a time, have %#v", captures["timestamp"])
+	}
+	if captures["clientip"] != "127.0.0.1" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	// explicit types win, values that cannot be converted are kept
+	captures, _ = g.ParseTyped(`%{NUMBER:n:float} %{INT:i:string} %{TIMESTAMP_ISO8601:ts}`, "3 12 2024-02-30 10:00")
+	if captures["n"] != 3.0 || captures["i"] != "12" || captures["ts"] != "2024-02-30 10:00" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	// Parse is not affected
+	values, _ := g.Parse("%{COMMONAPACHELOG}", text)
+	if values["response"] != "404" {
+		t.Fatalf("unexpected captures %#v", values)
+	}
+}
+
+func TestInferTypesAliases(t *testing.T) {
+	g, _ := NewWithConfig(&Config{InferTypes: true})
+	g.AddPattern("MYNUM", `(?:%{NUMBER})`)
+	g.AddPattern("PORT", `%{MYNUM}`)
+	g.AddPattern("TWO", `%{INT}-%{INT}`)
+
+	captures, err := g.ParseTyped(`%{PORT:port} %{TWO:two} %{INT}`, "8080 1-2 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["port"] != 8080 || captures["two"] != "1-2" || captures["INT"] != 7 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	g, _ = NewWithConfig(&Config{NamedCapturesOnly: true})
+	captures, _ = g.ParseTyped(`%{INT:i}`, "7")
+	if captures["i"] != "7" {
+		t.Fatalf("types should not be inferred by default, have %#v", captures)
+	}
+}
@@ -0,0 +1,161 @@
+package grok
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Definition describes a pattern loaded in a Grok object.
+type Definition struct {
+	Name     string
+	Params   []string // parameters of a macro pattern such as QUOTED(X)
+	Raw      string   // expression as it was added
+	Expanded string   // expression with every reference expanded
+	Source   Source   // location of the definition, zero when not read from a file
+}
+
+// Field describes a capture produced by a grok expression.
+type Field struct {
+	Name    string   // semantic name, or syntax name of an unnamed capture
+	Pattern string   // syntax pattern the value is matched with, empty for a named group (?<name>...)
+	Type    string   // declared type, empty for strings
+	Path    []string // nested path of [a][b] style names
+}
+
+// Patterns returns the sorted names of the loaded patterns.
+func (g *Grok) Patterns() []string {
+	g.patternsGuard.RLock()
+	defer g.patternsGuard.RUnlock()
+
+	names := make([]string, 0, len(g.patterns))
+	for name := range g.patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PatternDefinition returns the raw and expanded expressions of the named
+// pattern. The error of a pattern that cannot be used, such as a CompatError,
+// is returned along with its raw expression.
+func (g *Grok) PatternDefinition(name string) (Definition, error) {
+	g.patternsGuard.RLock()
+	defer g.patternsGuard.RUnlock()
+
+	p, ok := g.patterns[name]
+	if !ok {
+		return Definition{}, fmt.Errorf("no pattern found for %%{%s}", name)
+	}
+	def := Definition{
+		Name:     name,
+		Raw:      g.rawPattern[name],
+		Expanded: p.expression,
+		Source:   g.sources[name],
+	}
+	if p.macro != nil {
+		// macros are only expanded when called
+		def.Params = p.macro.params
+		def.Raw = p.macro.body
+	}
+	return def, p.err
+}
+
+// Fields returns the captures the specified grok expression produces, in
+// the order their references and Oniguruma named groups appear once
+// expanded.
+func (g *Grok) Fields(pattern string) ([]Field, error) {
+	gr, err := g.compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	g.patternsGuard.RLock()
+	defer g.patternsGuard.RUnlock()
+
+	var fields []Field
+	group := func(name string) {
+		name = strings.SplitN(name, ":", 2)[0]
+		fields = append(fields, Field{Name: name, Type: gr.typeInfo[name], Path: g.fieldPath(name)})
+	}
+	var walk func(expression string) error
+	walk = func(expression string) error {
+		groups := onigGroups(expression)
+		for _, match := range normal.FindAllStringSubmatchIndex(expression, -1) {
+			for len(groups) > 0 && groups[0][0] < match[0] {
+				group(expression[groups[0][2]:groups[0][3]])
+				groups = groups[1:]
+			}
+			ref, err := parseReference(expression[match[2]:match[3]])
+			if err != nil {
+				return err
+			}
+			if ref.named || !g.config.NamedCapturesOnly {
+				fields = append(fields, Field{
+					Name:    ref.semantic,
+					Pattern: ref.syntax,
+					Type:    gr.typeInfo[ref.semantic],
+					Path:    g.fieldPath(ref.semantic),
+				})
+			}
+			if err := walk(g.rawExpression(ref.syntax)); err != nil {
+				return err
+			}
+		}
+		for _, match := range groups {
+			group(expression[match[2]:match[3]])
+		}
+		return nil
+	}
+
+	if err := walk(pattern); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Dependencies returns the sorted names of the patterns the named pattern
+// references directly.
+func (g *Grok) Dependencies(name string) ([]string, error) {
+	g.patternsGuard.RLock()
+	defer g.patternsGuard.RUnlock()
+
+	if _, ok := g.patterns[name]; !ok {
+		return nil, fmt.Errorf("no pattern found for %%{%s}", name)
+	}
+	return uniqueSorted(g.dependencies[name]), nil
+}
+
+// Dependents returns the sorted names of the patterns referencing the named
+// pattern directly.
+func (g *Grok) Dependents(name string) ([]string, error) {
+	g.patternsGuard.RLock()
+	defer g.patternsGuard.RUnlock()
+
+	if _, ok := g.patterns[name]; !ok {
+		return nil, fmt.Errorf("no pattern found for %%{%s}", name)
+	}
+	var dependents []string
+	for parent, deps := range g.dependencies {
+		for _, dep := range deps {
+			if dep == name {
+				dependents = append(dependents, parent)
+				break
+			}
+		}
+	}
+	return uniqueSorted(dependents), nil
+}
+
+func uniqueSorted(s []string) []string {
+	seen := map[string]bool{}
+	r := []string{}
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			r = append(r, v)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,103 @@
+package grok
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPatternsList(t *testing.T) {
+	g, _ := NewWithConfig(&Config{SkipDefaultPatterns: true})
+	g.AddPatternsFromMap(map[string]string{
+		"NO3": `\d{3}`,
+		"NO6": "%{NO3}%{NO3}",
+	})
+
+	if names := g.Patterns(); fmt.Sprint(names) != "[NO3 NO6]" {
+		t.Fatalf("Patterns should return [NO3 NO6], have %v", names)
+	}
+}
+
+func TestPatternDefinition(t *testing.T) {
+	g, _ := NewWithConfig(&Config{SkipDefaultPatterns: true, NamedCapturesOnly: true})
+	g.AddPatternsFromMap(map[string]string{
+		"NO3": `\d{3}`,
+		"NO6": "%{NO3}%{NO3}",
+	})
+
+	def, err := g.PatternDefinition("NO6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Raw != "%{NO3}%{NO3}" {
+		t.Fatalf("raw definition should be '%%{NO3}%%{NO3}', have '%s'", def.Raw)
+	}
+	if def.Expanded != `(\d{3})(\d{3})` {
+		t.Fatalf("expanded definition should be '(\\d{3})(\\d{3})', have '%s'", def.Expanded)
+	}
+
+	if _, err := g.PatternDefinition("NO9"); err == nil {
+		t.Fatal("PatternDefinition should return an error for an unknown pattern")
+	}
+}
+
+func TestFields(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	g.AddPattern("SIZE", `%{NUMBER:[size][value]:float} %{WORD:[size][unit]}`)
+
+	fields, err := g.Fields("%{IP:client} %{SIZE} %{POSINT:port:int}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Field{
+		{Name: "client", Pattern: "IP"},
+		{Name: "[size][value]", Pattern: "NUMBER", Type: "float", Path: []string{"size", "value"}},
+		{Name: "[size][unit]", Pattern: "WORD", Path: []string{"size", "unit"}},
+		{Name: "port", Pattern: "POSINT", Type: "int"},
+	}
+	if fmt.Sprint(fields) != fmt.Sprint(expected) {
+		t.Fatalf("Fields should return %v, have %v", expected, fields)
+	}
+
+	g, _ = New()
+	fields, _ = g.Fields("%{IPORHOST:client}")
+	if len(fields) != 5 || fields[1].Name != "IP" || fields[4].Pattern != "HOSTNAME" {
+		t.Fatalf("Fields should list unnamed captures in default capture mode, have %v", fields)
+	}
+
+	if _, err := g.Fields("%{UNKNOWN}"); err == nil {
+		t.Fatal("Fields should return an error for an unknown pattern")
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	g, _ := New()
+
+	deps, err := g.Dependencies("IPORHOST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(deps) != "[HOSTNAME IP]" {
+		t.Fatalf("IPORHOST should depend on [HOSTNAME IP], have %v", deps)
+	}
+
+	dependents, err := g.Dependents("IPORHOST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range dependents {
+		if d == "COMMONAPACHELOG" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("COMMONAPACHELOG should depend on IPORHOST, have %v", dependents)
+	}
+
+	if _, err := g.Dependencies("UNKNOWN"); err == nil {
+		t.Fatal("Dependencies should return an error for an unknown pattern")
+	}
+	if _, err := g.Dependents("UNKNOWN"); err == nil {
+		t.Fatal("Dependents should return an error for an unknown pattern")
+	}
+}
@@ -0,0 +1,176 @@
+package grok
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// signature matches the name of a parameterized pattern definition, such as
+// QUOTED(X) or PAIR(K,V).
+var signature = regexp.MustCompile(`^(\w+(?:[-.]\w+)*)\((\w+(?:,\w+)*)\)$`)
+
+// identifier matches the pattern names of a reference syntax, including the
+// ones given as macro arguments.
+var identifier = regexp.MustCompile(`[\w.-]+`)
+
+// macro is a parameterized pattern, e.g. QUOTED(X) "%{X}". Its body is
+// expanded at each call, such as %{QUOTED(IP):client}, once the parameters are
+// substituted by the arguments.
+type macro struct {
+	params []string
+	body   string
+}
+
+// patternName returns the name of a pattern definition key and, when the key
+// is a macro signature, the names of its parameters.
+func patternName(key string) (name string, params []string, err error) {
+	if !strings.ContainsRune(key, '(') {
+		return key, nil, nil
+	}
+	m := signature.FindStringSubmatch(key)
+	if m == nil {
+		return "", nil, fmt.Errorf("invalid macro signature %q", key)
+	}
+	params = strings.Split(m[2], ",")
+	seen := map[string]bool{}
+	for _, param := range params {
+		if seen[param] {
+			return "", nil, fmt.Errorf("macro %q: duplicate parameter %q", key, param)
+		}
+		seen[param] = true
+	}
+	return m[1], params, nil
+}
+
+// setRaw stores a raw definition in raw, replacing any definition of the same
+// pattern under another signature.
+func setRaw(raw map[string]string, key, expression string) {
+	name, _, _ := patternName(key)
+	for k := range raw {
+		if k != key && (k == name || strings.HasPrefix(k, name+"(")) {
+			if n, _, _ := patternName(k); n == name {
+				delete(raw, k)
+			}
+		}
+	}
+	raw[key] = expression
+}
+
+// parseCall splits the syntax of a reference into the called pattern name and
+// its arguments, nil when the syntax is a plain pattern name.
+func parseCall(syntax string) (name string, args []string, err error) {
+	invalid := fmt.Errorf("invalid macro call %q", syntax)
+	open := strings.IndexByte(syntax, '(')
+	if open < 0 {
+		return syntax, nil, nil
+	}
+	if identifier.FindString(syntax[:open]) != syntax[:open] || open == 0 {
+		return "", nil, invalid
+	}
+
+	depth, start := 0, open+1
+	for i := start; i < len(syntax); i++ {
+		c := syntax[i]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ')' || (c == ',' && depth == 0):
+			arg := syntax[start:i]
+			if _, _, err := parseCall(arg); err != nil || arg == "" {
+				return "", nil, invalid
+			}
+			args = append(args, arg)
+			start = i + 1
+			if c == ')' {
+				if i != len(syntax)-1 {
+					return "", nil, invalid
+				}
+				return syntax[:open], args, nil
+			}
+		}
+	}
+	return "", nil, invalid
+}
+
+// calledNames returns every pattern name a reference syntax uses, the called
+// macro along with the patterns given as arguments.
+func calledNames(syntax string) []string {
+	return identifier.FindAllString(syntax, -1)
+}
+
+// expand returns the body of m with its parameters substituted by args in
+// every reference.
+func (m *macro) expand(name string, args []string) (string, error) {
+	if len(args) != len(m.params) {
+		return "", fmt.Errorf("macro %%{%s} takes %d arguments, have %d", name, len(m.params), len(args))
+	}
+	values := make(map[string]string, len(args))
+	for i, param := range m.params {
+		values[param] = args[i]
+	}
+
+	return normal.ReplaceAllStringFunc(m.body, func(ref string) string {
+		content := ref[2 : len(ref)-1]
+		syntax, rest := content, ""
+		if i := strings.IndexAny(content, ":|="); i >= 0 {
+			syntax, rest = content[:i], content[i:]
+		}
+		syntax = identifier.ReplaceAllStringFunc(syntax, func(id string) string {
+			if value, ok := values[id]; ok {
+				return value
+			}
+			return id
+		})
+		return "%{" + syntax + rest + "}"
+	}), nil
+}
+
+// callPattern returns the stored pattern a reference syntax designates,
+// expanding macro calls. Expansions always end: macros may not call their
+// parameters and cyclic definitions are rejected when they are stored.
+func (g *Grok) callPattern(syntax string, storedPatterns map[string]*gPattern) (*gPattern, error) {
+	name, args, err := parseCall(syntax)
+	if err != nil {
+		return nil, err
+	}
+	storedPattern, ok := storedPatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("no pattern found for %%{%s}", name)
+	}
+	if storedPattern.err != nil {
+		return nil, storedPattern.err
+	}
+	if storedPattern.macro == nil {
+		if args != nil {
+			return nil, fmt.Errorf("pattern %%{%s} is not a macro", name)
+		}
+		return storedPattern, nil
+	}
+	if args == nil {
+		return nil, fmt.Errorf("macro %%{%s} takes %d arguments", name, len(storedPattern.macro.params))
+	}
+
+	body, err := storedPattern.macro.expand(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return g.denormalizePattern(name, body, storedPatterns)
+}
+
+// rawExpression returns the raw expression a reference syntax designates, the
+// substituted body of a macro call. It must be called with patternsGuard held.
+func (g *Grok) rawExpression(syntax string) string {
+	name, args, err := parseCall(syntax)
+	if err != nil || args == nil {
+		return g.rawPattern[syntax]
+	}
+	p, ok := g.patterns[name]
+	if !ok || p.macro == nil {
+		return ""
+	}
+	body, _ := p.macro.expand(name, args)
+	return body
+}
@@ -0,0 +1,115 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMacro(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	if err := g.AddPattern("QUOTED(X)", `"%{X}"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddPattern("PAIR(K,V)", `%{K:key}=%{V:value}`); err != nil {
+		t.Fatal(err)
+	}
+
+	captures, err := g.Parse("%{QUOTED(IP):client} %{QUOTED(WORD):verb}", `"10.0.0.1" "GET"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["client"] != `"10.0.0.1"` || captures["verb"] != `"GET"` {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	captures, _ = g.Parse("%{PAIR(WORD,INT)}", "retries=3")
+	if captures["key"] != "retries" || captures["value"] != "3" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	// macro calls may be nested
+	captures, _ = g.Parse("%{QUOTED(QUOTED(INT)):n}", `""12""`)
+	if captures["n"] != `""12""` {
+		t.Fatalf("n should be '\"\"12\"\"' have '%s'", captures["n"])
+	}
+}
+
+func TestMacroTypes(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	g.AddPattern("BRACKETED(X)", `\[%{X:inner:int}\]`)
+	g.AddPattern("SIZE", `%{BRACKETED(INT)}`)
+	g.AddPattern("OPTIONAL(X)", `(?:%{X})?`)
+
+	captures, err := g.ParseTyped("%{OPTIONAL(NUMBER):n:float} %{SIZE}", `1.5 [42]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["inner"] != 42 {
+		t.Fatalf("inner should be 42 have %#v", captures["inner"])
+	}
+	if captures["n"] != 1.5 {
+		t.Fatalf("n should be 1.5 have %#v", captures["n"])
+	}
+}
+
+func TestMacroFromFile(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	err := g.AddPatternsFromReader(strings.NewReader(`
+BRACKETED(X) \[%{X}\]
+STAMP %{BRACKETED(HTTPDATE):timestamp}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	captures, _ := g.Parse("%{STAMP}", "[23/Apr/2014:22:58:32 +0200]")
+	if captures["timestamp"] != "[23/Apr/2014:22:58:32 +0200]" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	def, err := g.PatternDefinition("BRACKETED")
+	if err != nil || def.Raw != `\[%{X}\]` || len(def.Params) != 1 {
+		t.Fatalf("unexpected definition %+v, %v", def, err)
+	}
+	deps, _ := g.Dependencies("STAMP")
+	if strings.Join(deps, ",") != "BRACKETED,HTTPDATE" {
+		t.Fatalf("unexpected dependencies %v", deps)
+	}
+
+	// redefining a macro without parameters replaces it
+	g.AddPattern("BRACKETED", `<%{INT}>`)
+	if _, err := g.Parse("%{BRACKETED(INT)}", "[1]"); err == nil {
+		t.Fatal("BRACKETED is not a macro anymore")
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	g.AddPattern("QUOTED(X)", `"%{X}"`)
+
+	for _, pattern := range []string{"%{QUOTED}", "%{QUOTED(IP,IP)}", "%{IP(WORD)}", "%{QUOTED(NOPE)}", "%{QUOTED(IP}"} {
+		if _, err := g.Parse(pattern, "x"); err == nil {
+			t.Errorf("%s should not compile", pattern)
+		}
+	}
+
+	for name, pattern := range map[string]string{
+		"BAD(X,X)": `%{X}`,
+		"BAD(X":    `%{X}`,
+		"CALL(X)":  `%{X(IP)}`,
+		"UNKNOWN":  `%{QUOTED(NOPE)}`,
+	} {
+		g, _ := NewWithConfig(&Config{Patterns: map[string]string{"QUOTED(X)": `"%{X}"`}})
+		if err := g.AddPattern(name, pattern); err == nil {
+			t.Errorf("%s should be rejected", name)
+		}
+	}
+
+	g, _ = New()
+	err := g.AddPatternsFromMap(map[string]string{
+		"A(X)": `%{B(X)}`,
+		"B(X)": `%{A(X)}`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Fatalf("cyclic macros should be rejected, have %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package grok
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Modifier normalises a captured value, it is applied with the
+// %{SYNTAX:SEMANTIC|name} syntax. Modifiers are applied in order, before the
+// value is converted to its type.
+type Modifier func(value string) (string, error)
+
+// builtinModifiers are the modifiers available to every Grok object.
+var builtinModifiers = map[string]Modifier{
+	"lower": func(v string) (string, error) { return strings.ToLower(v), nil },
+	"upper": func(v string) (string, error) { return strings.ToUpper(v), nil },
+	"trim":  func(v string) (string, error) { return strings.TrimSpace(v), nil },
+	"unquote": func(v string) (string, error) {
+		if len(v) >= 2 && v[0] == v[len(v)-1] && strings.IndexByte("\"'`", v[0]) >= 0 {
+			return v[1 : len(v)-1], nil
+		}
+		return v, nil
+	},
+	"urldecode": url.PathUnescape,
+}
+
+// newModifiers returns the built-in modifiers along with the configured ones.
+func newModifiers(configured map[string]Modifier) map[string]Modifier {
+	modifiers := make(map[string]Modifier, len(builtinModifiers)+len(configured))
+	for name, m := range builtinModifiers {
+		modifiers[name] = m
+	}
+	for name, m := range configured {
+		modifiers[name] = m
+	}
+	return modifiers
+}
+
+// AddModifier registers a modifier under name, for the expressions compiled
+// afterwards. A registered modifier cannot be replaced, expressions already
+// compiled with it would keep the previous one.
+func (g *Grok) AddModifier(name string, m Modifier) error {
+	g.patternsGuard.Lock()
+	defer g.patternsGuard.Unlock()
+
+	if _, ok := g.modifiers[name]; ok {
+		return fmt.Errorf("modifier %q already defined", name)
+	}
+	g.modifiers[name] = m
+	return nil
+}
+
+// resolveModifiers returns the registered modifiers designated by names. It
+// must be called with patternsGuard held.
+func (g *Grok) resolveModifiers(names semanticModifiers) (map[string][]Modifier, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	modifiers := make(map[string][]Modifier, len(names))
+	for semantic, chain := range names {
+		for _, name := range chain {
+			m, ok := g.modifiers[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown modifier %q for %s", name, semantic)
+			}
+			modifiers[semantic] = append(modifiers[semantic], m)
+		}
+	}
+	return modifiers, nil
+}
+
+// modify applies the modifiers of the semantic name to a captured value.
+func (gr *gRegexp) modify(semantic, value string) (string, error) {
+	for _, m := range gr.modifiers[semantic] {
+		v, err := m(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot modify %s value %q: %w", semantic, value, err)
+		}
+		value = v
+	}
+	return value, nil
+}
@@ -0,0 +1,93 @@
+package grok
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestModifiers(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	pattern := `%{WORD:verb|lower} %{URIPATH:path|urldecode} %{QS:agent|unquote} %{QS:quoted|unquote|upper}`
+	text := `GET /a%20b "curl/7.1" 'x'`
+
+	captures, err := g.Parse(pattern, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"verb": "get", "path": "/a b", "agent": "curl/7.1", "quoted": "X"}
+	for name, value := range expected {
+		if captures[name] != value {
+			t.Errorf("%s should be %q have %q", name, value, captures[name])
+		}
+	}
+
+	multi, _ := g.ParseToMultiMap(pattern, text)
+	if multi["verb"][0] != "get" {
+		t.Fatalf("verb should be 'get' have %q", multi["verb"])
+	}
+
+	if _, err := g.Parse(`%{URIPATH:path|urldecode}`, "/a%zz"); err == nil {
+		t.Fatal("invalid escapes should fail")
+	}
+}
+
+func TestModifiersTyped(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	g.AddPattern("PADDED", `\s*\d+\s*`)
+
+	captures, err := g.ParseTyped(`\[%{PADDED:n:int|trim}\] %{DATA:msg|trim}$`, "[ 42 ]  hello ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["n"] != 42 || captures["msg"] != "hello" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	// values emptied by a modifier are removed
+	g, _ = NewWithConfig(&Config{NamedCapturesOnly: true, RemoveEmptyValues: true})
+	values, _ := g.Parse(`a%{SPACE:space|trim}b`, "a  b")
+	if _, ok := values["space"]; ok {
+		t.Fatalf("space should be removed, have %v", values)
+	}
+}
+
+func TestCustomModifiers(t *testing.T) {
+	reverse := func(v string) (string, error) {
+		r := []rune(v)
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	}
+	g, _ := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		Modifiers:         map[string]Modifier{"reverse": reverse},
+	})
+
+	if _, err := g.Parse(`%{WORD:w|nope}`, "abc"); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Fatalf("unknown modifiers should be reported, have %v", err)
+	}
+	captures, _ := g.Parse(`%{WORD:w|reverse|upper}`, "abc")
+	if captures["w"] != "CBA" {
+		t.Fatalf("w should be 'CBA' have %q", captures["w"])
+	}
+
+	failure := errors.New("failure")
+	if err := g.AddModifier("fail", func(string) (string, error) { return "", failure }); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddModifier("lower", reverse); err == nil {
+		t.Fatal("built-in modifiers cannot be replaced")
+	}
+	if _, err := g.Parse(`%{WORD:w|fail}`, "abc"); !errors.Is(err, failure) {
+		t.Fatalf("modifier errors should be returned, have %v", err)
+	}
+
+	// modifiers declared in patterns apply to the expressions using them
+	g.AddPattern("VERB", `%{WORD:verb|lower}`)
+	captures, _ = g.Parse(`%{VERB}`, "POST")
+	if captures["verb"] != "post" {
+		t.Fatalf("verb should be 'post' have %q", captures["verb"])
+	}
+}
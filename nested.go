@@ -0,0 +1,56 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NestedFieldSyntax tells which semantic names designate nested fields.
+type NestedFieldSyntax int
+
+const (
+	// NestedBrackets nests the fields named as [source][ip].
+	NestedBrackets NestedFieldSyntax = iota
+	// NestedBracketsAndDots also nests the fields named as source.ip.
+	NestedBracketsAndDots
+)
+
+// fieldPath returns the nested path of a semantic name according to
+// Config.NestedFieldSyntax, nil when the name is not nested.
+func (g *Grok) fieldPath(name string) []string {
+	if path := nestedPath(name); len(path) > 0 {
+		return path
+	}
+	if g.config.NestedFieldSyntax != NestedBracketsAndDots || !strings.Contains(name, ".") {
+		return nil
+	}
+	path := strings.Split(name, ".")
+	for _, element := range path {
+		if element == "" {
+			return nil
+		}
+	}
+	return path
+}
+
+// setField stores the value of the named field in m, in nested maps when path
+// is set. It reports fields conflicting with the ones already stored.
+func setField(m map[string]interface{}, name string, path []string, value interface{}) error {
+	if len(path) == 0 {
+		path = []string{name}
+	}
+	if err := addNested(m, path, value); err != nil {
+		return fmt.Errorf("field %s: %v", name, err)
+	}
+	return nil
+}
+
+// ParseNested parses the specified text and returns a map with the results,
+// nested fields being stored in nested maps, see Config.NestedFieldSyntax.
+func (g *Grok) ParseNested(pattern, text string) (map[string]interface{}, error) {
+	captures, err := g.ParseOrdered(pattern, text)
+	if err != nil {
+		return nil, err
+	}
+	return captures.Nested()
+}
@@ -0,0 +1,77 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNestedDots(t *testing.T) {
+	pattern := `%{IP:source.ip}:%{INT:source.port:int} %{WORD:[http][method]}`
+	text := "10.0.0.1:80 GET"
+
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	captures, _ := g.ParseTyped(pattern, text)
+	if captures["source.ip"] != "10.0.0.1" {
+		t.Fatalf("dotted names should not be nested by default, have %#v", captures)
+	}
+
+	g, _ = NewWithConfig(&Config{NamedCapturesOnly: true, NestedFieldSyntax: NestedBracketsAndDots})
+	captures, err := g.ParseTyped(pattern, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := captures["source"].(map[string]interface{})
+	if source["ip"] != "10.0.0.1" || source["port"] != 80 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	if captures["http"].(map[string]interface{})["method"] != "GET" {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+
+	nested, err := g.ParseNested(pattern, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nested["source"].(map[string]interface{})["port"] != "80" {
+		t.Fatalf("unexpected captures %#v", nested)
+	}
+
+	fields, _ := g.Fields(pattern)
+	if strings.Join(fields[0].Path, "/") != "source/ip" {
+		t.Fatalf("unexpected path %q", fields[0].Path)
+	}
+}
+
+func TestFlattenNested(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, FlattenNested: true})
+	pattern := `%{IP:[source][ip]} %{INT:[source][port]:int|trim}`
+
+	values, _ := g.Parse(pattern, "10.0.0.1 80")
+	if values["source.ip"] != "10.0.0.1" || values["source.port"] != "80" {
+		t.Fatalf("unexpected captures %#v", values)
+	}
+	typed, _ := g.ParseTyped(pattern, "10.0.0.1 80")
+	if typed["source.port"] != 80 {
+		t.Fatalf("types should apply to flattened fields, have %#v", typed)
+	}
+	multi, _ := g.ParseToMultiMap(pattern, "10.0.0.1 80")
+	if len(multi["source.ip"]) != 1 {
+		t.Fatalf("unexpected captures %#v", multi)
+	}
+}
+
+func TestNestedConflicts(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+
+	for _, pattern := range []string{
+		`%{WORD:a} %{WORD:[a][b]}`,
+		`%{WORD:[a][b]} %{WORD:a}`,
+	} {
+		if _, err := g.ParseTyped(pattern, "x y"); err == nil {
+			t.Errorf("%s: conflicting fields should be reported", pattern)
+		}
+		if _, err := g.ParseNested(pattern, "x y"); err == nil {
+			t.Errorf("%s: conflicting fields should be reported", pattern)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package grok
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// onigName matches the name of an Oniguruma named group, optionally followed
+// by a type as in %{SYNTAX:SEMANTIC:TYPE} references.
+var onigName = regexp.MustCompile(`^((\[[\w.@-]+\])+|[\w.@-]+)(:(string|float|int))?$`)
+
+// onigGroup finds the Oniguruma named groups (?<name>...) of an expression.
+var onigGroup = regexp.MustCompile(`\(\?<([^>=!][^>]*)>`)
+
+// onigGroups returns the offsets of the named groups of expression and of
+// their names, as translated by translateOniguruma.
+func onigGroups(expression string) [][]int {
+	var groups [][]int
+	for _, match := range onigGroup.FindAllStringSubmatchIndex(expression, -1) {
+		if (match[0] == 0 || expression[match[0]-1] != '\\') && onigName.MatchString(expression[match[2]:match[3]]) {
+			groups = append(groups, match)
+		}
+	}
+	return groups
+}
+
+// CompatError reports a construct of an Oniguruma expression, the regexp
+// flavour of Logstash pattern files, that cannot be translated.
+type CompatError struct {
+	Pattern   string // name of the pattern, empty for a parsed expression
+	Offset    int    // byte offset of the construct in the expression
+	Construct string
+}
+
+func (e *CompatError) Error() string {
+	if e.Pattern == "" {
+		return fmt.Sprintf("unsupported %s at offset %d", e.Construct, e.Offset)
+	}
+	return fmt.Sprintf("pattern %%{%s}: unsupported %s at offset %d", e.Pattern, e.Construct, e.Offset)
+}
+
+// translateOniguruma rewrites the Oniguruma constructs of a piece of the
+// expression of the named pattern. Named groups (?<name>...) become aliased
+// captures, recording their type in ti and their alias in names. Lookarounds,
+// atomic groups, possessive quantifiers and backreferences are kept when the
+// engine supports them. offset is the position of the piece in the
+// expression, used to locate the constructs that cannot be translated.
+func (g *Grok) translateOniguruma(name, expression string, offset int, ti semanticTypes, names captureNames) (string, error) {
+	unsupported := func(i int, construct string) error {
+		return &CompatError{Pattern: name, Offset: offset + i, Construct: construct}
+	}
+
+	var result strings.Builder
+	quantified := false // the previous token is a quantifier
+	for i := 0; i < len(expression); i++ {
+		c := expression[i]
+		wasQuantified := quantified
+		quantified = false
+
+		switch {
+		case c == '\\' && i+1 < len(expression):
+			next := expression[i+1]
+			switch {
+			case next >= '1' && next <= '9' && !g.supports("backreference"):
+				return "", unsupported(i, "backreference")
+			case next == 'k' && i+2 < len(expression) && expression[i+2] == '<':
+				if !g.supports("backreference") {
+					return "", unsupported(i, "backreference")
+				}
+				end := strings.IndexByte(expression[i:], '>')
+				if end < 0 || !onigName.MatchString(expression[i+3:i+end]) {
+					return "", unsupported(i, "backreference")
+				}
+				// the referenced group is aliased as well
+				result.WriteString("\\k<")
+				result.WriteString(names.alias(expression[i+3 : i+end]))
+				result.WriteString(">")
+				i += end
+				continue
+			}
+			result.WriteString(expression[i : i+2])
+			i++
+
+		case c == '[':
+			end := classEnd(expression, i)
+			result.WriteString(expression[i:end])
+			i = end - 1
+
+		case strings.HasPrefix(expression[i:], "(?<=") || strings.HasPrefix(expression[i:], "(?<!"):
+			if !g.supports("lookbehind") {
+				return "", unsupported(i, "lookbehind")
+			}
+			result.WriteString(expression[i : i+4])
+			i += 3
+
+		case strings.HasPrefix(expression[i:], "(?=") || strings.HasPrefix(expression[i:], "(?!"):
+			if !g.supports("lookahead") {
+				return "", unsupported(i, "lookahead")
+			}
+			result.WriteString(expression[i : i+3])
+			i += 2
+
+		case strings.HasPrefix(expression[i:], "(?>"):
+			if !g.supports("atomic group") {
+				return "", unsupported(i, "atomic group")
+			}
+			result.WriteString(expression[i : i+3])
+			i += 2
+
+		case strings.HasPrefix(expression[i:], "(?<"):
+			end := strings.IndexByte(expression[i:], '>')
+			if end < 0 || !onigName.MatchString(expression[i+3:i+end]) {
+				return "", unsupported(i, "group name")
+			}
+			group := strings.SplitN(expression[i+3:i+end], ":", 2)
+			if len(group) == 2 {
+				ti[group[0]] = group[1]
+			}
+			result.WriteString("(?P<")
+			result.WriteString(names.alias(group[0]))
+			result.WriteString(">")
+			i += end
+
+		case c == '+' && wasQuantified:
+			if !g.supports("possessive quantifier") {
+				return "", unsupported(i, "possessive quantifier")
+			}
+			result.WriteByte(c)
+
+		case c == '*' || c == '+' || c == '?':
+			result.WriteByte(c)
+			// a ? following a quantifier makes it lazy
+			quantified = !(c == '?' && wasQuantified)
+
+		case c == '{' && repetition.MatchString(expression[i:]):
+			n := len(repetition.FindString(expression[i:]))
+			result.WriteString(expression[i : i+n])
+			i += n - 1
+			// as in Ruby, a + following {n,m} repeats the repetition
+			// instead of making it possessive
+
+		default:
+			result.WriteByte(c)
+		}
+	}
+
+	return result.String(), nil
+}
+
+var repetition = regexp.MustCompile(`^\{\d+(,\d*)?\}`)
+
+// classEnd returns the offset following the character class starting at
+// expression[start].
+func classEnd(expression string, start int) int {
+	i := start + 1
+	if i < len(expression) && expression[i] == '^' {
+		i++
+	}
+	// a leading ] is a literal
+	if i < len(expression) && expression[i] == ']' {
+		i++
+	}
+	for i < len(expression) {
+		switch {
+		case expression[i] == '\\':
+			i++
+		case strings.HasPrefix(expression[i:], "[:"):
+			if end := strings.Index(expression[i:], ":]"); end >= 0 {
+				i += end + 1
+			}
+		case expression[i] == ']':
+			return i + 1
+		}
+		i++
+	}
+	return len(expression)
+}
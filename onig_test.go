@@ -0,0 +1,114 @@
+package grok
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestOnigurumaNamedGroups(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, RemoveEmptyValues: true})
+	g.AddPattern("RCONTROLLER", `(?<controller>[^#]+)#(?<action>\w+)`)
+	g.AddPattern("REQ", `(?<[http][status]:int>\d{3}) (?<[http][method]>%{WORD})(?<empty>x?)`)
+
+	captures, err := g.Parse("%{RCONTROLLER}", "UsersController#show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["controller"] != "UsersController" || captures["action"] != "show" {
+		t.Fatalf("unexpected captures %v", captures)
+	}
+
+	typed, err := g.ParseTyped("%{REQ}", "404 GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	http, ok := typed["http"].(map[string]interface{})
+	if !ok || http["status"] != 404 || http["method"] != "GET" {
+		t.Fatalf("unexpected typed captures %v", typed)
+	}
+	if _, ok := typed["empty"]; ok {
+		t.Fatal("empty named group should be removed")
+	}
+}
+
+func TestOnigurumaUnsupportedConstructs(t *testing.T) {
+	tests := []struct {
+		expression string
+		construct  string
+		offset     int
+	}{
+		{`\{ (?<={ ).*`, "lookbehind", 3},
+		{`.*(?= } ntoreturn:)`, "lookahead", 2},
+		{`(?!<[0-9])%{HOUR}`, "lookahead", 0},
+		{`(?>\d\d){1,2}`, "atomic group", 0},
+		{`\d++`, "possessive quantifier", 3},
+		{`(a)\1`, "backreference", 3},
+		{`(?<x>a)\k<x>`, "backreference", 7},
+		{`%{WORD} (?<bad name>a)`, "group name", 8},
+	}
+
+	g, _ := New()
+	for _, test := range tests {
+		g.AddPattern("UNSUPPORTED", test.expression)
+		_, err := g.Parse("%{UNSUPPORTED}", "")
+		var compatErr *CompatError
+		if !errors.As(err, &compatErr) {
+			t.Fatalf("%s should raise a CompatError, have %v", test.expression, err)
+		}
+		expected := CompatError{Pattern: "UNSUPPORTED", Offset: test.offset, Construct: test.construct}
+		if *compatErr != expected {
+			t.Errorf("%s should raise %v, have %v", test.expression, expected, *compatErr)
+		}
+	}
+}
+
+func TestOnigurumaSupportedConstructs(t *testing.T) {
+	g, _ := New()
+	for _, expression := range []string{`[(?<=]\d+?`, `\(?<x\)`, `a{2}?b*?`, `(?P<name>x)`, `[]\\d]+`, `[[:alpha:]]+`} {
+		if _, err := g.Match(expression, "x"); err != nil {
+			t.Errorf("%s should compile, have %v", expression, err)
+		}
+	}
+}
+
+func TestOnigurumaPatternsDir(t *testing.T) {
+	g, err := NewWithConfig(&Config{PatternsDir: []string{"./patterns"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captures, err := g.Parse("%{BACULA_LOG_NO_CONNECT}", "Warning: bsock.c:127 Could not connect to Storage daemon on backup.example.com:9103. ERR=Connection refused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captures["berror"] != "Connection refused" {
+		t.Fatalf("berror should be 'Connection refused' have '%s'", captures["berror"])
+	}
+
+	// translated named groups are listed as fields, along with their type
+	fields, err := g.Fields("%{BACULA_LOG_NO_CONNECT}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"BACULA_LOG_NO_CONNECT", "client", "HOSTNAME", "POSINT", "berror", "GREEDYDATA"}) {
+		t.Fatalf("unexpected fields %v", names)
+	}
+	fields, _ = g.Fields(`(?<n:int>\d+) %{WORD:w}`)
+	if len(fields) != 2 || fields[0].Name != "n" || fields[0].Type != "int" || fields[0].Pattern != "" || fields[1].Name != "w" {
+		t.Fatalf("unexpected fields %+v", fields)
+	}
+
+	_, err = g.Parse("%{MONGO_SLOWQUERY}", "")
+	var compatErr *CompatError
+	if !errors.As(err, &compatErr) || compatErr.Pattern != "MONGO_QUERY" {
+		t.Fatalf("MONGO_SLOWQUERY should report the lookbehind of MONGO_QUERY, have %v", err)
+	}
+	if _, err := g.PatternDefinition("MONGO_QUERY"); err == nil {
+		t.Fatal("PatternDefinition should report the error of MONGO_QUERY")
+	}
+}
@@ -0,0 +1,203 @@
+package grok
+
+import (
+	"bufio"
+	"io"
+)
+
+// Capture is a field of a parsed text.
+type Capture struct {
+	Name  string
+	Value string
+	Path  []string // nested path of the field, nil when it is not nested
+}
+
+// Captures are the fields of a parsed text, in the order of their first
+// capture in the expression.
+type Captures []Capture
+
+// Map returns the captures as a map, as returned by Parse.
+func (c Captures) Map() map[string]string {
+	m := make(map[string]string, len(c))
+	for _, capture := range c {
+		m[capture.Name] = capture.Value
+	}
+	return m
+}
+
+// Nested returns the captures as a map, nested fields being stored in nested
+// maps. Conflicting fields, such as a and [a][b], are reported.
+func (c Captures) Nested() (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(c))
+	for _, capture := range c {
+		if err := setField(m, capture.Name, capture.Path, capture.Value); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Get returns the value of the named field.
+func (c Captures) Get(name string) (string, bool) {
+	for _, capture := range c {
+		if capture.Name == name {
+			return capture.Value, true
+		}
+	}
+	return "", false
+}
+
+// TypedCapture is a field of a parsed text, converted to its type.
+type TypedCapture struct {
+	Name  string
+	Value interface{}
+	Path  []string // nested path of the field, nil when it is not nested
+}
+
+// TypedCaptures are the typed fields of a parsed text, in the order of their
+// first capture in the expression.
+type TypedCaptures []TypedCapture
+
+// Map returns the captures as a map, as returned by ParseTyped. Nested fields
+// are stored in nested maps, conflicting ones are dropped.
+func (c TypedCaptures) Map() map[string]interface{} {
+	m, _ := c.nested(false)
+	return m
+}
+
+// nested returns the captures as a map, nested fields being stored in nested
+// maps. When strict is set, the first conflicting field is reported.
+func (c TypedCaptures) nested(strict bool) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(c))
+	for _, capture := range c {
+		err := setField(m, capture.Name, capture.Path, capture.Value)
+		if err != nil && strict {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Get returns the value of the named field.
+func (c TypedCaptures) Get(name string) (interface{}, bool) {
+	for _, capture := range c {
+		if capture.Name == name {
+			return capture.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ParseOrdered parses the specified text and returns the captured fields in
+// the order of the expression.
+func (g *Grok) ParseOrdered(pattern, text string) (Captures, error) {
+	gr, err := g.compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return g.compiledParseOrdered(gr, text)
+}
+
+// ParseOrderedTyped parses the specified text and returns the typed captured
+// fields in the order of the expression.
+func (g *Grok) ParseOrderedTyped(pattern, text string) (TypedCaptures, error) {
+	gr, err := g.compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return g.compiledParseOrderedTyped(gr, text)
+}
+
+// ParseStreamOrdered works as ParseStream, the fields of each line being
+// given to process in the order of the expression.
+func (g *Grok) ParseStreamOrdered(reader *bufio.Reader, pattern string, process func(Captures) error) error {
+	gr, err := g.compile(pattern)
+	if err != nil {
+		return err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		values, err := g.compiledParseOrdered(gr, line)
+		if err != nil {
+			return err
+		}
+		if err = process(values); err != nil {
+			return err
+		}
+	}
+}
+
+// ParseOrdered returns the captured fields in the order of the expression.
+func (c *CompiledPattern) ParseOrdered(text string) (Captures, error) {
+	return c.g.compiledParseOrdered(c.gr, text)
+}
+
+// ParseOrderedTyped returns the typed captured fields in the order of the
+// expression.
+func (c *CompiledPattern) ParseOrderedTyped(text string) (TypedCaptures, error) {
+	return c.g.compiledParseOrderedTyped(c.gr, text)
+}
+
+func (g *Grok) compiledParseOrdered(gr *gRegexp, text string) (Captures, error) {
+	captured, _, err := g.captures(gr, text)
+	if err != nil {
+		return nil, err
+	}
+	return g.orderedCaptures(captured)
+}
+
+// orderedCaptures returns the fields of the captures.
+func (g *Grok) orderedCaptures(captured []capture) (Captures, error) {
+	captures := make(Captures, 0, len(captured))
+	for _, f := range fields(captured) {
+		value, err := g.value(f)
+		if err != nil {
+			return nil, err
+		}
+		captures = append(captures, Capture{Name: f.name, Value: value, Path: f.path})
+	}
+	return captures, nil
+}
+
+func (g *Grok) compiledParseOrderedTyped(gr *gRegexp, text string) (TypedCaptures, error) {
+	captured, _, err := g.captures(gr, text)
+	if err != nil {
+		return nil, err
+	}
+	return g.typedCaptures(gr, captured)
+}
+
+// typedCaptures converts the captures of gr to their types.
+func (g *Grok) typedCaptures(gr *gRegexp, captured []capture) (TypedCaptures, error) {
+	var err error
+	captures := make(TypedCaptures, 0, len(captured))
+	for _, f := range fields(captured) {
+		var value interface{}
+		if g.config.DuplicateFields == DuplicateFieldsCollect && len(f.values) > 1 {
+			values := nonEmpty(f.values)
+			typed := make([]interface{}, len(values))
+			for i, v := range values {
+				if typed[i], err = g.typedValue(gr, f.semantic, v); err != nil {
+					return nil, err
+				}
+			}
+			value = typed
+		} else {
+			v, err := g.value(f)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = g.typedValue(gr, f.semantic, v); err != nil {
+				return nil, err
+			}
+		}
+		captures = append(captures, TypedCapture{Name: f.name, Value: value, Path: f.path})
+	}
+	return captures, nil
+}
@@ -0,0 +1,80 @@
+package grok
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParseOrdered(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+
+	captures, err := g.ParseOrdered("%{COMMONAPACHELOG}", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range captures {
+		names = append(names, c.Name)
+	}
+	expected := "clientip,ident,auth,timestamp,verb,request,httpversion,rawrequest,response,bytes"
+	if strings.Join(names, ",") != expected {
+		t.Fatalf("fields should be ordered as %s, have %s", expected, strings.Join(names, ","))
+	}
+
+	parsed, _ := g.Parse("%{COMMONAPACHELOG}", text)
+	m := captures.Map()
+	if len(m) != len(parsed) {
+		t.Fatalf("map view should be %v, have %v", parsed, m)
+	}
+	for k, v := range parsed {
+		if m[k] != v {
+			t.Fatalf("map view should be %v, have %v", parsed, m)
+		}
+	}
+	if v, ok := captures.Get("verb"); !ok || v != "GET" {
+		t.Fatalf("verb should be 'GET' have %q", v)
+	}
+	if _, ok := captures.Get("nope"); ok {
+		t.Fatal("unknown fields should not be found")
+	}
+}
+
+func TestParseOrderedTyped(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	captures, err := g.ParseOrderedTyped(`%{WORD:[a][name]} %{INT:n:int} %{NUMBER:[a][f]:float}`, "x 1 2.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 3 || captures[0].Name != "[a][name]" || captures[1].Value != 1 || captures[2].Value != 2.5 {
+		t.Fatalf("unexpected captures %#v", captures)
+	}
+	nested := captures.Map()["a"].(map[string]interface{})
+	if nested["name"] != "x" || nested["f"] != 2.5 {
+		t.Fatalf("unexpected map view %#v", captures.Map())
+	}
+
+	c, _ := g.Compile(`%{INT:n:int}`)
+	typed, _ := c.ParseOrderedTyped("12")
+	if v, _ := typed.Get("n"); v != 12 {
+		t.Fatalf("n should be 12 have %#v", v)
+	}
+}
+
+func TestParseStreamOrdered(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	reader := bufio.NewReader(strings.NewReader("b=1\na=2\n"))
+
+	var lines []string
+	err := g.ParseStreamOrdered(reader, `%{WORD:key}=%{INT:value}`, func(c Captures) error {
+		lines = append(lines, c[0].Name+":"+c[0].Value+","+c[1].Name+":"+c[1].Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, " ") != "key:b,value:1 key:a,value:2" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
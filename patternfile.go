@@ -0,0 +1,331 @@
+package grok
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var errNoPatternFiles = errors.New("no pattern files found")
+
+// Source locates the definition of a pattern read from a pattern file.
+type Source struct {
+	File string
+	Line int
+}
+
+func (s Source) String() string {
+	if s.File == "" {
+		return fmt.Sprintf("line %d", s.Line)
+	}
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// DuplicatePolicy tells how a pattern defined more than once in pattern files
+// is handled.
+type DuplicatePolicy int
+
+const (
+	// DuplicateOverwrite keeps the last definition read.
+	DuplicateOverwrite DuplicatePolicy = iota
+	// DuplicateWarn keeps the last definition read and reports the duplicate
+	// through Config.Warn.
+	DuplicateWarn
+	// DuplicateError fails the loading of the pattern files.
+	DuplicateError
+)
+
+// patternDef is a pattern definition read from a pattern file.
+type patternDef struct {
+	name       string
+	expression string
+	source     Source
+	rules      []rule // rules annotating the definition
+}
+
+// readPatterns reads the pattern definitions of a pattern file. Each line that
+// is neither empty nor a comment holds a pattern name and its expression,
+// separated by whitespace. Comments starting with @rule annotate the next
+// definition with a validation rule, see parseRule. file is used to locate
+// definitions and errors.
+func readPatterns(r io.Reader, file string) ([]patternDef, error) {
+	var defs []patternDef
+	var rules []rule
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		l := strings.TrimSpace(scanner.Text())
+		if len(l) == 0 {
+			continue
+		}
+		if l[0] == '#' {
+			if annotation := strings.TrimSpace(l[1:]); strings.HasPrefix(annotation, "@rule") {
+				r, err := parseRule(annotation)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", Source{File: file, Line: line}, err)
+				}
+				rules = append(rules, r)
+			}
+			continue
+		}
+
+		source := Source{File: file, Line: line}
+		i := strings.IndexFunc(l, unicode.IsSpace)
+		if i < 0 {
+			return nil, fmt.Errorf("%s: pattern %q has no expression", source, l)
+		}
+		defs = append(defs, patternDef{
+			name:       l[:i],
+			expression: strings.TrimSpace(l[i:]),
+			source:     source,
+			rules:      rules,
+		})
+		rules = nil
+	}
+	if rules != nil {
+		return nil, fmt.Errorf("%s: rules annotating no pattern", Source{File: file, Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return defs, nil
+}
+
+// patternLoad gathers the definitions of a set of pattern files before adding
+// them all at once, detecting patterns defined more than once.
+type patternLoad struct {
+	g        *Grok
+	patterns map[string]string
+	sources  map[string]Source
+	rules    map[string][]rule
+}
+
+func (g *Grok) newPatternLoad() *patternLoad {
+	return &patternLoad{
+		g:        g,
+		patterns: map[string]string{},
+		sources:  map[string]Source{},
+		rules:    map[string][]rule{},
+	}
+}
+
+// add records the definitions of a pattern file. A definition is a duplicate
+// when the pattern was already read during this load, or was loaded earlier
+// from another file. Readers are distinct sources, even without file name.
+func (l *patternLoad) add(defs []patternDef) error {
+	for _, def := range defs {
+		name, _, err := patternName(def.name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", def.source, err)
+		}
+		prev, ok := l.sources[name]
+		if !ok {
+			l.g.patternsGuard.RLock()
+			prev, ok = l.g.sources[name]
+			l.g.patternsGuard.RUnlock()
+			// only a named file read again keeps its patterns
+			ok = ok && (def.source.File == "" || prev.File != def.source.File)
+		}
+
+		if ok {
+			err := fmt.Errorf("%s: pattern %q already defined at %s", def.source, def.name, prev)
+			switch l.g.config.DuplicatePatterns {
+			case DuplicateError:
+				return err
+			case DuplicateWarn:
+				l.g.warn(err)
+			}
+		}
+
+		setRaw(l.patterns, def.name, def.expression)
+		l.sources[name] = def.source
+		if def.rules != nil {
+			l.rules[name] = def.rules
+		} else {
+			delete(l.rules, name)
+		}
+	}
+	return nil
+}
+
+// commit adds the gathered definitions to the Grok object.
+func (l *patternLoad) commit() error {
+	patterns := l.patterns
+	if !l.g.configured && l.g.config.ECSPatternsDir {
+		// pattern files of the configuration
+		patterns = l.g.ecsShippedPatterns(patterns)
+	}
+	return l.g.addRawPatterns(patterns, l.sources, l.rules)
+}
+
+// AddPatternsFromReader adds the patterns defined in r, using the pattern
+// file syntax, to the list of loaded patterns.
+func (g *Grok) AddPatternsFromReader(r io.Reader) error {
+	defs, err := readPatterns(r, "")
+	if err != nil {
+		return err
+	}
+	load := g.newPatternLoad()
+	if err := load.add(defs); err != nil {
+		return err
+	}
+	return load.commit()
+}
+
+// AddPatternsFromFS adds the patterns defined in the files of fsys matching
+// glob to the list of loaded patterns. glob uses the path.Match syntax, and a
+// "**" element matches any number of directories.
+func (g *Grok) AddPatternsFromFS(fsys fs.FS, glob string) error {
+	err := g.addPatternsFromFS(fsys, glob, func(name string) string { return name })
+	if err == errNoPatternFiles {
+		return fmt.Errorf("no pattern files match %s", glob)
+	}
+	return err
+}
+
+// addPatternsFromFS loads the files of fsys matching glob. locate turns a path
+// of fsys into the file name used to locate definitions.
+func (g *Grok) addPatternsFromFS(fsys fs.FS, glob string, locate func(string) string) error {
+	files, err := globFS(fsys, glob)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errNoPatternFiles
+	}
+
+	load := g.newPatternLoad()
+	for _, name := range files {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+
+		defs, err := readPatterns(file, locate(name))
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+		if err := load.add(defs); err != nil {
+			return err
+		}
+	}
+
+	return load.commit()
+}
+
+// globFS returns the regular files of fsys matching glob, in lexical order.
+func globFS(fsys fs.FS, glob string) ([]string, error) {
+	if !strings.Contains(glob, "**") {
+		matches, err := fs.Glob(fsys, glob)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, name := range matches {
+			if fi, err := fs.Stat(fsys, name); err == nil && !fi.IsDir() {
+				files = append(files, name)
+			}
+		}
+		return files, nil
+	}
+
+	// walk from the deepest directory free of wildcards
+	elems := strings.Split(glob, "/")
+	root := "."
+	for i, elem := range elems[:len(elems)-1] {
+		if hasMeta(elem) {
+			break
+		}
+		root = path.Join(elems[:i+1]...)
+	}
+
+	var files []string
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		ok, err := matchDoublestar(elems, strings.Split(name, "/"))
+		if ok {
+			files = append(files, name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// matchDoublestar reports whether the path elements match the glob elements,
+// a "**" glob element matching zero or more path elements.
+func matchDoublestar(glob, name []string) (bool, error) {
+	if len(glob) == 0 {
+		return len(name) == 0, nil
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if ok, err := matchDoublestar(glob[1:], name[i:]); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	if len(name) == 0 {
+		return false, nil
+	}
+	ok, err := path.Match(glob[0], name[0])
+	if !ok || err != nil {
+		return false, err
+	}
+	return matchDoublestar(glob[1:], name[1:])
+}
+
+// hasMeta reports whether s contains glob wildcards.
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// splitGlob splits a file system glob into the directory holding every match
+// and a slash separated glob relative to that directory.
+func splitGlob(glob string) (base, rel string) {
+	elems := strings.Split(filepath.ToSlash(glob), "/")
+	i := 0
+	for i < len(elems)-1 && !hasMeta(elems[i]) {
+		i++
+	}
+	base = filepath.FromSlash(strings.Join(elems[:i], "/"))
+	switch {
+	case base == "" && i > 0:
+		base = string(filepath.Separator)
+	case base == "":
+		base = "."
+	}
+	return base, strings.Join(elems[i:], "/")
+}
+
+// warn reports a non fatal problem through Config.Warn, or the standard logger
+// when it is not set.
+func (g *Grok) warn(err error) {
+	if g.config.Warn != nil {
+		g.config.Warn(err)
+		return
+	}
+	log.Printf("grok: %v", err)
+}
@@ -0,0 +1,225 @@
+package grok
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func writePatternFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPatterns(t *testing.T) {
+	defs, err := readPatterns(strings.NewReader("# comment\n\nSPACED \\d+  \nTABBED\t\t\\w+\n  INDENTED .*\n"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []patternDef{
+		{name: "SPACED", expression: `\d+`, source: Source{File: "test", Line: 3}},
+		{name: "TABBED", expression: `\w+`, source: Source{File: "test", Line: 4}},
+		{name: "INDENTED", expression: `.*`, source: Source{File: "test", Line: 5}},
+	}
+	if len(defs) != len(expected) {
+		t.Fatalf("readPatterns should return %d definitions, have %d", len(expected), len(defs))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(defs[i], expected[i]) {
+			t.Fatalf("definition %d should be %+v, have %+v", i, expected[i], defs[i])
+		}
+	}
+}
+
+func TestReadPatternsMissingExpression(t *testing.T) {
+	_, err := readPatterns(strings.NewReader("GOOD \\d+\nLONELY\n"), "test")
+	if err == nil || !strings.HasPrefix(err.Error(), "test:2:") {
+		t.Fatalf("readPatterns should report the line of a pattern without expression, have %v", err)
+	}
+}
+
+func TestAddPatternsFromPathMissingExpression(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "broken", "LONELY\n")
+
+	g, _ := New()
+	if err := g.AddPatternsFromPath(dir); err == nil {
+		t.Fatal("AddPatternsFromPath should return an error instead of panicking")
+	}
+}
+
+func TestAddPatternsFromPathErrorLocation(t *testing.T) {
+	dir := t.TempDir()
+	path := writePatternFile(t, dir, "custom", "OK \\d+\nBROKEN %{NOPE}\n")
+
+	g, _ := New()
+	err := g.AddPatternsFromPath(dir)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":2:") {
+		t.Fatalf("error should be located at %s:2, have %v", path, err)
+	}
+}
+
+func TestPatternSource(t *testing.T) {
+	dir := t.TempDir()
+	path := writePatternFile(t, dir, "custom", "# custom patterns\nNO3 \\d{3}\n")
+
+	g, _ := New()
+	if err := g.AddPatternsFromPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	def, _ := g.PatternDefinition("NO3")
+	if def.Source != (Source{File: path, Line: 2}) {
+		t.Fatalf("NO3 should be defined at %s:2, have %s", path, def.Source)
+	}
+
+	g.AddPattern("NO3", `\d\d\d`)
+	def, _ = g.PatternDefinition("NO3")
+	if def.Source != (Source{}) {
+		t.Fatalf("NO3 source should be cleared when redefined, have %s", def.Source)
+	}
+}
+
+func TestDuplicatePatterns(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "a", "NO3 \\d{3}\n")
+	writePatternFile(t, dir, "b", "NO3 [0-9]{3}\n")
+
+	g, _ := NewWithConfig(&Config{DuplicatePatterns: DuplicateError})
+	if err := g.AddPatternsFromPath(dir); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Fatalf("duplicate patterns should fail, have %v", err)
+	}
+
+	var warnings []error
+	g, _ = NewWithConfig(&Config{
+		DuplicatePatterns: DuplicateWarn,
+		Warn:              func(err error) { warnings = append(warnings, err) },
+	})
+	if err := g.AddPatternsFromPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("duplicate patterns should raise 1 warning, have %v", warnings)
+	}
+	if raw := g.rawPattern["NO3"]; raw != "[0-9]{3}" {
+		t.Fatalf("last definition should win, have %s", raw)
+	}
+
+	// loading the same files again does not redefine patterns
+	warnings = nil
+	g.AddPatternsFromPath(filepath.Join(dir, "b"))
+	if len(warnings) != 0 {
+		t.Fatalf("reloading a file should not raise warnings, have %v", warnings)
+	}
+	g.AddPatternsFromPath(filepath.Join(dir, "a"))
+	if len(warnings) != 1 {
+		t.Fatalf("loading a pattern defined in another file should raise a warning, have %v", warnings)
+	}
+
+	// readers are distinct sources
+	g, _ = NewWithConfig(&Config{DuplicatePatterns: DuplicateError})
+	if err := g.AddPatternsFromReader(strings.NewReader("X a\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddPatternsFromReader(strings.NewReader("X b\n")); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Fatalf("patterns redefined by a reader should fail, have %v", err)
+	}
+	if raw := g.rawPattern["X"]; raw != "a" {
+		t.Fatalf("first definition should be kept, have %s", raw)
+	}
+}
+
+func TestAddPatternsFromReader(t *testing.T) {
+	g, _ := NewWithConfig(&Config{SkipDefaultPatterns: true})
+	if err := g.AddPatternsFromReader(strings.NewReader("NO3 \\d{3}\nNO6 %{NO3}%{NO3}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if captures, _ := g.Parse("%{NO6:number}", "123456"); captures["number"] != "123456" {
+		t.Fatalf("number should be '123456' have '%s'", captures["number"])
+	}
+
+	err := g.AddPatternsFromReader(strings.NewReader("OK \\d\nBROKEN\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Fatalf("error should be located at line 2, have %v", err)
+	}
+}
+
+func TestAddPatternsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"patterns/base":             {Data: []byte("NO3 \\d{3}\n")},
+		"patterns/http/status":      {Data: []byte("STATUS %{NO3}\n")},
+		"patterns/http/v2/protocol": {Data: []byte("PROTO HTTP/2\n")},
+		"patterns/README.md":        {Data: []byte("not a pattern file\n")},
+	}
+
+	g, _ := NewWithConfig(&Config{SkipDefaultPatterns: true})
+	if err := g.AddPatternsFromFS(fsys, "patterns/base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddPatternsFromFS(fsys, "patterns/http/**/*"); err != nil {
+		t.Fatal(err)
+	}
+	if names := g.Patterns(); fmt.Sprint(names) != "[NO3 PROTO STATUS]" {
+		t.Fatalf("patterns should be [NO3 PROTO STATUS], have %v", names)
+	}
+	def, _ := g.PatternDefinition("PROTO")
+	if def.Source != (Source{File: "patterns/http/v2/protocol", Line: 1}) {
+		t.Fatalf("PROTO should be defined at patterns/http/v2/protocol:1, have %s", def.Source)
+	}
+
+	if err := g.AddPatternsFromFS(fsys, "patterns/*.grok"); err == nil {
+		t.Fatal("AddPatternsFromFS should return an error when no file matches")
+	}
+}
+
+func TestMatchDoublestar(t *testing.T) {
+	tests := []struct {
+		glob, name string
+		match      bool
+	}{
+		{"**/*", "a", true},
+		{"**/*", "a/b/c", true},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/b/c", true},
+		{"a/**/c", "a/b/d", false},
+		{"a/**", "a/b/c", true},
+		{"a/*", "a/b/c", false},
+	}
+	for _, test := range tests {
+		ok, err := matchDoublestar(strings.Split(test.glob, "/"), strings.Split(test.name, "/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.match {
+			t.Errorf("%s matching %s should be %v", test.glob, test.name, test.match)
+		}
+	}
+}
+
+func TestConfigPatternsDirGlob(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom.grok", "NO3 \\d{3}\n")
+	writePatternFile(t, dir, "ignored.txt", "BROKEN\n")
+
+	g, err := NewWithConfig(&Config{PatternsDir: []string{filepath.Join(dir, "*.grok")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.PatternDefinition("NO3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWithConfig(&Config{PatternsDir: []string{filepath.Join(dir, "*.none")}}); err == nil {
+		t.Fatal("NewWithConfig should return an error when a glob matches no file")
+	}
+	if _, err := NewWithConfig(&Config{PatternsDir: []string{t.TempDir()}}); err != nil {
+		t.Fatalf("an empty directory should not be an error, have %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package grok
+
+// PatternSet matches texts against several grok expressions, the first
+// matching one in order winning. Only the expressions whose required literals
+// occur in a text are run, the literals being found in a single scan.
+type PatternSet struct {
+	g        *Grok
+	patterns []string
+	compiled []*gRegexp
+	filtered []bool // whether the expression runs only when its literals occur
+	literals *ahoCorasick
+}
+
+// NewPatternSet compiles the grok expressions of a PatternSet.
+func (g *Grok) NewPatternSet(patterns []string) (*PatternSet, error) {
+	s := &PatternSet{
+		g:        g,
+		patterns: patterns,
+		compiled: make([]*gRegexp, len(patterns)),
+		filtered: make([]bool, len(patterns)),
+	}
+	var all []string
+	var keys []int
+	for i, pattern := range patterns {
+		gr, err := g.compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.compiled[i] = gr
+		l := requiredLiterals(gr.regexp.String())
+		for _, literal := range l {
+			all = append(all, literal)
+			keys = append(keys, i)
+		}
+		s.filtered[i] = l != nil
+	}
+	s.literals = newAhoCorasick(all, keys)
+	return s, nil
+}
+
+// Patterns returns the expressions of the set, in order.
+func (s *PatternSet) Patterns() []string {
+	return s.patterns
+}
+
+// candidates returns whether each expression may match text.
+func (s *PatternSet) candidates(text string) []bool {
+	candidates := make([]bool, len(s.patterns))
+	for i, filtered := range s.filtered {
+		candidates[i] = !filtered
+	}
+	s.literals.find(text, func(i int) {
+		candidates[i] = true
+	})
+	return candidates
+}
+
+// Match returns the index of the first expression matching text, -1 when
+// none does.
+func (s *PatternSet) Match(text string) (int, error) {
+	for i, candidate := range s.candidates(text) {
+		if !candidate {
+			continue
+		}
+		ok, err := s.g.compiledMatch(s.compiled[i], text)
+		if err != nil {
+			return -1, err
+		}
+		if ok {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// Parse parses text with the first matching expression and returns its
+// index along with the results, see Grok.Parse. The index is -1 when no
+// expression matches.
+func (s *PatternSet) Parse(text string) (int, map[string]string, error) {
+	i, err := s.Match(text)
+	if i < 0 {
+		return i, nil, err
+	}
+	values, err := s.g.compiledParse(s.compiled[i], text)
+	return i, values, err
+}
+
+// ParseTyped parses text with the first matching expression and returns its
+// index along with the typed results, see Grok.ParseTyped.
+func (s *PatternSet) ParseTyped(text string) (int, map[string]interface{}, error) {
+	i, err := s.Match(text)
+	if i < 0 {
+		return i, nil, err
+	}
+	values, err := s.g.compiledParseTyped(s.compiled[i], text)
+	return i, values, err
+}
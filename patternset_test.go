@@ -0,0 +1,120 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+var firewallLines = []string{
+	`<166>Jun 24 2024 10:00:00 fw01 : %ASA-6-302013: Built inbound TCP connection 123 for outside:10.0.0.1/443 (10.0.0.1/443) to inside:10.0.0.2/51234 (10.0.0.2/51234)`,
+	`<164>Jun 24 2024 10:00:01 fw01 : %ASA-4-106023: Deny tcp src outside:10.0.0.1/4431 dst inside:10.0.0.2/80 by access-group "outside_in" [0x0, 0x0]`,
+	`<161>Jun 24 2024 10:00:02 fw01 : %ASA-1-104001: (Primary) Switching to ACTIVE - mate down`,
+	`<161>Jun 24 2024 10:00:03 fw01 : %ASA-1-106021: Deny TCP reverse path check from 10.0.0.1 to 10.0.0.2 on interface outside`,
+	`<166>Jun 24 2024 10:00:04 fw01 : %ASA-6-313001: Denied ICMP type=8, code=0 from 10.0.0.1 on interface outside`,
+	`<166>Jun 24 2024 10:00:05 fw01 : %ASA-6-999999: nothing known`,
+}
+
+// firewallSet returns the expressions of the Cisco ASA messages.
+func firewallSet(t testing.TB) (*Grok, []string) {
+	g, err := NewWithConfig(&Config{NamedCapturesOnly: true, PatternsDir: []string{"./patterns/firewalls"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns []string
+	for _, name := range g.Patterns() {
+		if strings.HasPrefix(name, "CISCOFW") {
+			patterns = append(patterns, "%{CISCO_TAGGED_SYSLOG} %{"+name+"}")
+		}
+	}
+	return g, patterns
+}
+
+// firstMatch returns the index of the first expression matching text.
+func firstMatch(t testing.TB, g *Grok, patterns []string, text string) int {
+	for i, pattern := range patterns {
+		ok, err := g.Match(pattern, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestPatternSet(t *testing.T) {
+	g, patterns := firewallSet(t)
+	set, err := g.NewPatternSet(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range firewallLines {
+		i, values, err := set.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := firstMatch(t, g, patterns, line); i != expected {
+			t.Fatalf("%s: expected expression %d, have %d", line, expected, i)
+		}
+		if i >= 0 && values["ciscotag"] == "" {
+			t.Fatalf("%s: unexpected captures %v", line, values)
+		}
+	}
+
+	i, values, _ := set.Parse(firewallLines[0])
+	if set.Patterns()[i] != "%{CISCO_TAGGED_SYSLOG} %{CISCOFW302013_302014_302015_302016}" || values["connection_id"] != "123" {
+		t.Fatalf("unexpected expression %d and captures %v", i, values)
+	}
+	i, typed, _ := set.ParseTyped(firewallLines[2])
+	if typed["switch_reason"] != "mate down" {
+		t.Fatalf("unexpected expression %d and captures %v", i, typed)
+	}
+	if i, values, err := set.Parse(firewallLines[5]); i != -1 || values != nil || err != nil {
+		t.Fatalf("no expression should match, have %d, %v, %v", i, values, err)
+	}
+}
+
+func TestPatternSetWithoutLiterals(t *testing.T) {
+	g, _ := New()
+	set, err := g.NewPatternSet([]string{`%{INT:n}x`, `%{WORD:w}`, `%{NUMBER:n}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for text, expected := range map[string]int{"12x": 0, "12": 1, "!": -1} {
+		if i, _ := set.Match(text); i != expected {
+			t.Fatalf("%s: expected expression %d, have %d", text, expected, i)
+		}
+	}
+
+	if _, err := g.NewPatternSet([]string{"%{UNKNOWN}"}); err == nil {
+		t.Fatal("an unknown pattern should be reported")
+	}
+}
+
+func BenchmarkPatternSet(b *testing.B) {
+	g, patterns := firewallSet(b)
+	set, _ := g.NewPatternSet(patterns)
+	compiled := make([]*CompiledPattern, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i], _ = g.Compile(pattern)
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, c := range compiled {
+				if ok, _ := c.Match(firewallLines[n%len(firewallLines)]); ok {
+					break
+				}
+			}
+		}
+	})
+	b.Run("prefiltered", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			set.Match(firewallLines[n%len(firewallLines)])
+		}
+	})
+}
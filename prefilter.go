@@ -0,0 +1,174 @@
+package grok
+
+import (
+	"regexp/syntax"
+)
+
+// maxLiterals bounds the number of literals required by an expression, an
+// alternation of more literals being too weak a filter.
+const maxLiterals = 64
+
+// requiredLiterals returns literals one of which occurs in every text an
+// expression matches, nil when there is none. Expressions with constructs
+// RE2 rejects have no required literals.
+func requiredLiterals(expression string) []string {
+	re, err := syntax.Parse(expression, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return literals(re)
+}
+
+// literals returns the required literals of re, see requiredLiterals.
+func literals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil
+		}
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return literals(re.Sub[0])
+		}
+	case syntax.OpAlternate:
+		var union []string
+		for _, sub := range re.Sub {
+			l := literals(sub)
+			if l == nil || len(union)+len(l) > maxLiterals {
+				return nil
+			}
+			union = append(union, l...)
+		}
+		return union
+	case syntax.OpConcat:
+		var best []string
+		run := ""
+		pick := func(l []string) {
+			if better(l, best) {
+				best = l
+			}
+		}
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 {
+				// adjacent literals make a longer one
+				run += string(sub.Rune)
+				continue
+			}
+			if run != "" {
+				pick([]string{run})
+				run = ""
+			}
+			pick(literals(sub))
+		}
+		if run != "" {
+			pick([]string{run})
+		}
+		return best
+	}
+	return nil
+}
+
+// better reports whether the literals a make a more selective filter than the
+// ones of b, their shortest literal being longer.
+func better(a, b []string) bool {
+	if a == nil {
+		return false
+	}
+	if b == nil {
+		return true
+	}
+	if shortest(a) != shortest(b) {
+		return shortest(a) > shortest(b)
+	}
+	return len(a) < len(b)
+}
+
+func shortest(l []string) int {
+	n := -1
+	for _, s := range l {
+		if n < 0 || len(s) < n {
+			n = len(s)
+		}
+	}
+	return n
+}
+
+// acNode is a state of an Aho-Corasick automaton.
+type acNode struct {
+	next   map[byte]int
+	fail   int
+	output []int // keys of the literals ending at this state
+}
+
+// ahoCorasick finds the literals occurring in a text in a single scan.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+// newAhoCorasick builds the automaton of literals, keys[i] being reported
+// when literals[i] occurs.
+func newAhoCorasick(literals []string, keys []int) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{next: map[byte]int{}}}}
+	for i, literal := range literals {
+		state := 0
+		for j := 0; j < len(literal); j++ {
+			next, ok := ac.nodes[state].next[literal[j]]
+			if !ok {
+				next = len(ac.nodes)
+				ac.nodes = append(ac.nodes, acNode{next: map[byte]int{}})
+				ac.nodes[state].next[literal[j]] = next
+			}
+			state = next
+		}
+		ac.nodes[state].output = append(ac.nodes[state].output, keys[i])
+	}
+
+	// failure links, breadth first
+	queue := []int{}
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[state].next {
+			fail := ac.nodes[state].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			ac.nodes[child].output = append(ac.nodes[child].output, ac.nodes[ac.nodes[child].fail].output...)
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// find calls found with the keys of the literals occurring in text.
+func (ac *ahoCorasick) find(text string, found func(key int)) {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[state].next[text[i]]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = ac.nodes[state].fail
+		}
+		for _, key := range ac.nodes[state].output {
+			found(key)
+		}
+	}
+}
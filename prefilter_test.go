@@ -0,0 +1,42 @@
+package grok
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRequiredLiterals(t *testing.T) {
+	for expression, expected := range map[string][]string{
+		`%ASA-\d-(?P<id>\d+): `:         {"%ASA-"},
+		`^\w+ connection (to|from) \d+`: {" connection "},
+		`(?:Built|Teardown) \w+`:        {"Built", "Teardown"},
+		`a(bc)+d`:                       {"bc"},
+		`x{2,3}`:                        {"x"},
+		`(?i)deny \d+`:                  nil,
+		`\w+(deny)?`:                    nil,
+		`(deny|\d+)`:                    nil,
+		`(?=x)y`:                        nil,
+	} {
+		literals := requiredLiterals(expression)
+		sort.Strings(literals)
+		if !reflect.DeepEqual(literals, expected) {
+			t.Errorf("%s: expected %q, have %q", expression, expected, literals)
+		}
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	ac := newAhoCorasick([]string{"he", "she", "his", "hers", "xyz"}, []int{0, 1, 2, 3, 4})
+	found := map[int]bool{}
+	ac.find("ushers", func(key int) { found[key] = true })
+	if !reflect.DeepEqual(found, map[int]bool{0: true, 1: true, 3: true}) {
+		t.Fatalf("unexpected literals %v", found)
+	}
+
+	found = map[int]bool{}
+	ac.find("hi", func(key int) { found[key] = true })
+	if len(found) != 0 {
+		t.Fatalf("unexpected literals %v", found)
+	}
+}
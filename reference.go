@@ -0,0 +1,65 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reference is a parsed %{SYNTAX:SEMANTIC:TYPE} pattern reference.
+type reference struct {
+	syntax    string
+	semantic  string // equals syntax when the reference is not named
+	typ       string
+	modifiers []string // applied in order, e.g. "lower" for %{WORD:verb|lower}
+	named     bool
+
+	defaultValue string // value of empty captures, e.g. "0" for %{NUMBER:n:int=0}
+	hasDefault   bool
+}
+
+// parseReference parses the content of a %{...} reference, e.g.
+// "WORD:field:int", "NUMBER:bytes:int=0" or "QS:agent|unquote".
+func parseReference(s string) (reference, error) {
+	if !valid.MatchString(s) {
+		return reference{}, fmt.Errorf("invalid pattern %%{%s}", s)
+	}
+
+	modifiers := strings.Split(s, "|")
+	value := strings.SplitN(modifiers[0], "=", 2)
+	names := strings.Split(value[0], ":")
+	ref := reference{syntax: names[0], semantic: names[0], modifiers: modifiers[1:]}
+	if len(names) > 1 {
+		ref.semantic = names[1]
+		ref.named = true
+	}
+	if len(names) > 2 {
+		ref.typ = names[2]
+	}
+	if len(value) > 1 {
+		ref.defaultValue, ref.hasDefault = value[1], true
+	}
+	return ref, nil
+}
+
+// references returns the references found in expression, in order.
+func references(expression string) ([]reference, error) {
+	var refs []reference
+	for _, key := range normal.FindAllStringSubmatch(expression, -1) {
+		ref, err := parseReference(key[1])
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// nestedPath returns the path of a [a][b] style semantic name, or nil when
+// the name is not nested.
+func nestedPath(name string) []string {
+	var path []string
+	for _, element := range nested.FindAllStringSubmatch(name, -1) {
+		path = append(path, element[1])
+	}
+	return path
+}
@@ -0,0 +1,239 @@
+package grok
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// Schema describes the fields ParseTyped returns for a grok expression.
+type Schema struct {
+	Fields []SchemaField // in the order of their first capture
+}
+
+// SchemaField describes a field of a Schema.
+type SchemaField struct {
+	Name string
+	Path []string // nested path of the field, nil when it is not nested
+	// Type is the type of the values: string, int, float, number (int or
+	// float) or time.
+	Type string
+	// Optional tells whether the field may be missing or empty, when all its
+	// captures sit in an optional group or in an alternation, or may capture
+	// an empty value removed by RemoveEmptyValues, and it has no default
+	// value.
+	Optional bool
+	// Repeated tells whether the values are collected in a slice, see
+	// DuplicateFieldsCollect. A single value is returned as is when the
+	// other captures are empty and removed by RemoveEmptyValues, or when a
+	// default value replaces them.
+	Repeated bool
+}
+
+// Schema returns the fields the specified grok expression produces with
+// ParseTyped, along with their types.
+func (g *Grok) Schema(pattern string) (Schema, error) {
+	gr, err := g.compile(pattern)
+	if err != nil {
+		return Schema{}, err
+	}
+	re, err := syntax.Parse(gr.regexp.String(), syntax.Perl)
+	if err != nil {
+		return Schema{}, fmt.Errorf("cannot analyse %q: %v", pattern, err)
+	}
+
+	var schema Schema
+	index := map[string]int{}
+	var walk func(re *syntax.Regexp, optional bool)
+	walk = func(re *syntax.Regexp, optional bool) {
+		switch re.Op {
+		case syntax.OpQuest, syntax.OpStar, syntax.OpAlternate:
+			optional = true
+		case syntax.OpRepeat:
+			optional = optional || re.Min == 0
+		case syntax.OpCapture:
+			if _, marker := gr.rules[re.Name]; re.Name != "" && !marker {
+				optional := optional || (g.config.RemoveEmptyValues && matchesEmpty(re))
+				name := gr.names.name(re.Name)
+				if i, ok := index[name]; ok {
+					f := &schema.Fields[i]
+					f.Optional = f.Optional && optional
+					f.Repeated = g.config.DuplicateFields == DuplicateFieldsCollect
+				} else {
+					index[name] = len(schema.Fields)
+					schema.Fields = append(schema.Fields, g.schemaField(gr, name, optional))
+				}
+			}
+		}
+		for _, sub := range re.Sub {
+			walk(sub, optional)
+		}
+	}
+	walk(re, false)
+
+	return schema, nil
+}
+
+// matchesEmpty reports whether re may match an empty text.
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpNoMatch, syntax.OpCharClass, syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		return false
+	case syntax.OpLiteral:
+		return len(re.Rune) == 0
+	case syntax.OpStar, syntax.OpQuest:
+		return true
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if matchesEmpty(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	// empty matches and assertions
+	return true
+}
+
+// schemaField describes the field of a semantic name.
+func (g *Grok) schemaField(gr *gRegexp, semantic string, optional bool) SchemaField {
+	f := SchemaField{Name: semantic, Type: "string", Optional: optional}
+	if path := g.fieldPath(semantic); len(path) > 0 {
+		if g.config.FlattenNested {
+			f.Name = strings.Join(path, ".")
+		} else {
+			f.Path = path
+		}
+	}
+
+	if typ, ok := gr.typeInfo[semantic]; ok {
+		f.Type = typ
+	} else if typ, ok := gr.fieldTypes[semantic]; ok {
+		f.Type = typ
+	} else if kind, ok := gr.inferred[semantic]; ok && g.config.InferTypes {
+		f.Type = kind
+	}
+
+	if g.defaultValue(gr, semantic) != "" {
+		f.Optional = false
+	}
+	return f
+}
+
+// JSONSchema returns the JSON Schema of the documents ParseTyped returns.
+func (s Schema) JSONSchema() ([]byte, error) {
+	jsonTypes := map[string]map[string]interface{}{
+		"string": {"type": "string"},
+		"int":    {"type": "integer"},
+		"float":  {"type": "number"},
+		"number": {"type": "number"},
+		"time":   {"type": "string", "format": "date-time"},
+	}
+	object := func() map[string]interface{} {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+
+	root := object()
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	for _, f := range s.Fields {
+		parent, name, err := s.parent(root, f, object)
+		if err != nil {
+			return nil, err
+		}
+		var property interface{} = jsonTypes[f.Type]
+		if f.Repeated {
+			property = map[string]interface{}{"type": "array", "items": property}
+		}
+		parent["properties"].(map[string]interface{})[name] = property
+		if !f.Optional {
+			// the objects holding a required field are required as well
+			path := f.Path
+			if len(path) == 0 {
+				path = []string{f.Name}
+			}
+			object := root
+			for i, element := range path {
+				required, _ := object["required"].([]string)
+				found := false
+				for _, name := range required {
+					found = found || name == element
+				}
+				if !found {
+					object["required"] = append(required, element)
+				}
+				if i < len(path)-1 {
+					object = object["properties"].(map[string]interface{})[element].(map[string]interface{})
+				}
+			}
+		}
+	}
+	return json.Marshal(root)
+}
+
+// ElasticsearchMapping returns the Elasticsearch index mapping of the
+// documents ParseTyped returns.
+func (s Schema) ElasticsearchMapping() ([]byte, error) {
+	esTypes := map[string]string{
+		"string": "keyword",
+		"int":    "long",
+		"float":  "double",
+		"number": "double",
+		"time":   "date",
+	}
+	object := func() map[string]interface{} {
+		return map[string]interface{}{"properties": map[string]interface{}{}}
+	}
+
+	root := object()
+	for _, f := range s.Fields {
+		parent, name, err := s.parent(root, f, object)
+		if err != nil {
+			return nil, err
+		}
+		parent["properties"].(map[string]interface{})[name] = map[string]interface{}{"type": esTypes[f.Type]}
+	}
+	return json.Marshal(map[string]interface{}{"mappings": root})
+}
+
+// parent returns the object holding the property of the field in a schema
+// tree, creating the objects of its nested path, and the name of the
+// property.
+func (s Schema) parent(root map[string]interface{}, f SchemaField, object func() map[string]interface{}) (map[string]interface{}, string, error) {
+	path := f.Path
+	if len(path) == 0 {
+		path = []string{f.Name}
+	}
+	parent := root
+	for _, element := range path[:len(path)-1] {
+		properties := parent["properties"].(map[string]interface{})
+		child, ok := properties[element].(map[string]interface{})
+		if ok {
+			_, ok = child["properties"]
+		}
+		if !ok {
+			if _, exists := properties[element]; exists {
+				return nil, "", fmt.Errorf("field %s: nesting under the field %s", f.Name, element)
+			}
+			child = object()
+			properties[element] = child
+		}
+		parent = child
+	}
+	name := path[len(path)-1]
+	if _, exists := parent["properties"].(map[string]interface{})[name]; exists {
+		return nil, "", fmt.Errorf("field %s: overwriting the field %s", f.Name, name)
+	}
+	return parent, name, nil
+}
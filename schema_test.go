@@ -0,0 +1,125 @@
+package grok
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, InferTypes: true, FieldTypes: map[string]string{"code": "int"}})
+
+	schema, err := g.Schema(`%{IP:[source][ip]} %{WORD:verb}( %{NUMBER:size:float})?( %{INT:code}|-) %{WORD:user=nobody} %{INT:count}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SchemaField{
+		{Name: "[source][ip]", Path: []string{"source", "ip"}, Type: "string"},
+		{Name: "verb", Type: "string"},
+		{Name: "size", Type: "float", Optional: true},
+		{Name: "code", Type: "int", Optional: true},
+		{Name: "user", Type: "string"},
+		{Name: "count", Type: "int"},
+	}
+	if !reflect.DeepEqual(schema.Fields, expected) {
+		t.Fatalf("expected %#v, have %#v", expected, schema.Fields)
+	}
+
+	if _, err := g.Schema("%{UNKNOWN}"); err == nil {
+		t.Fatal("an unknown pattern should be reported")
+	}
+}
+
+func TestSchemaRemoveEmptyValues(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, RemoveEmptyValues: true})
+
+	// fields whose captures may be empty are removed from the results
+	schema, err := g.Schema(`%{WORD:a} %{DATA:b} %{NOTSPACE:c=-}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SchemaField{
+		{Name: "a", Type: "string"},
+		{Name: "b", Type: "string", Optional: true},
+		{Name: "c", Type: "string"},
+	}
+	if !reflect.DeepEqual(schema.Fields, expected) {
+		t.Fatalf("expected %#v, have %#v", expected, schema.Fields)
+	}
+}
+
+func TestSchemaFieldsCapturedMoreThanOnce(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, DuplicateFields: DuplicateFieldsCollect})
+
+	schema, err := g.Schema(`%{WORD:a}( %{WORD:a})? (%{WORD:b}|%{INT:b})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SchemaField{
+		{Name: "a", Type: "string", Repeated: true},
+		{Name: "b", Type: "string", Optional: true, Repeated: true},
+	}
+	if !reflect.DeepEqual(schema.Fields, expected) {
+		t.Fatalf("expected %#v, have %#v", expected, schema.Fields)
+	}
+}
+
+func TestSchemaExports(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true, InferTypes: true})
+	schema, err := g.Schema(`%{IP:[source][ip]} %{INT:[source][port]} %{HTTPDATE:ts}( %{WORD:tag})?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := schema.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jsonSchema map[string]interface{}
+	json.Unmarshal(data, &jsonSchema)
+	expected := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"source": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"ip":   map[string]interface{}{"type": "string"},
+					"port": map[string]interface{}{"type": "integer"},
+				},
+				"required": []interface{}{"ip", "port"},
+			},
+			"ts":  map[string]interface{}{"type": "string", "format": "date-time"},
+			"tag": map[string]interface{}{"type": "string"},
+		},
+		"required": []interface{}{"source", "ts"},
+	}
+	if !reflect.DeepEqual(jsonSchema, expected) {
+		t.Fatalf("expected %v, have %v", expected, jsonSchema)
+	}
+
+	data, err = schema.ElasticsearchMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"mappings":{"properties":{"source":{"properties":{"ip":{"type":"keyword"},"port":{"type":"long"}}},"tag":{"type":"keyword"},"ts":{"type":"date"}}}}` {
+		t.Fatalf("unexpected mapping %s", data)
+	}
+
+	// the objects holding a required field are required up to the root
+	schema, _ = g.Schema(`%{WORD:[http][request][method]}( %{INT:[http][response][status_code]})?`)
+	data, _ = schema.JSONSchema()
+	jsonSchema = nil
+	json.Unmarshal(data, &jsonSchema)
+	http := jsonSchema["properties"].(map[string]interface{})["http"].(map[string]interface{})
+	if !reflect.DeepEqual(jsonSchema["required"], []interface{}{"http"}) || !reflect.DeepEqual(http["required"], []interface{}{"request"}) {
+		t.Fatalf("unexpected schema %s", data)
+	}
+
+	// a leaf cannot hold nested fields
+	g, _ = NewWithConfig(&Config{NamedCapturesOnly: true, NestedFieldSyntax: NestedBracketsAndDots})
+	schema, _ = g.Schema(`%{WORD:source} %{IP:source.ip}`)
+	if _, err := schema.JSONSchema(); err == nil {
+		t.Fatal("the conflicting fields should be reported")
+	}
+}
@@ -0,0 +1,122 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is a %{SYNTAX:SEMANTIC} reference of a parsed expression, along with
+// the references of the pattern it designates, as returned by ParseTree.
+type Node struct {
+	Name     string // semantic name, or syntax name of an unnamed reference
+	Pattern  string // syntax name, e.g. IPORHOST or QUOTED(IP)
+	Value    string // matched text, before any modifier or default value
+	Start    int    // byte offsets of the value in the text, -1 when the
+	End      int    // reference did not participate in the match
+	Children []*Node
+}
+
+// treeNode is a reference of an expression expanded by expandTree, captured
+// by the subexpression named group.
+type treeNode struct {
+	name, pattern string
+	group         string
+	children      []*treeNode
+}
+
+// ParseTree parses text with a grok expression and returns the tree of its
+// references, every one of them being captured whatever the configuration.
+// The root node stands for the whole expression. ParseTree returns a nil node
+// when the expression does not match. Tree expressions are not cached.
+func (g *Grok) ParseTree(pattern, text string) (*Node, error) {
+	g.patternsGuard.RLock()
+	counter := 0
+	expression, nodes, err := g.expandTree("", pattern, &counter)
+	g.patternsGuard.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := g.engine().Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := (&gRegexp{regexp: re}).submatchIndex(text)
+	if loc == nil {
+		return nil, err
+	}
+
+	groups := map[string]int{}
+	for i, name := range re.SubexpNames() {
+		groups[name] = i
+	}
+	var build func(nodes []*treeNode) []*Node
+	build = func(nodes []*treeNode) []*Node {
+		var children []*Node
+		for _, n := range nodes {
+			i := groups[n.group]
+			node := &Node{Name: n.name, Pattern: n.pattern, Start: loc[2*i], End: loc[2*i+1]}
+			if node.Start >= 0 {
+				node.Value = text[node.Start:node.End]
+			}
+			node.Children = build(n.children)
+			children = append(children, node)
+		}
+		return children
+	}
+
+	return &Node{
+		Pattern:  pattern,
+		Value:    text[loc[0]:loc[1]],
+		Start:    loc[0],
+		End:      loc[1],
+		Children: build(nodes),
+	}, nil
+}
+
+// expandTree expands the references of the expression of the named pattern
+// from the raw definitions, capturing each of them in a group of its own. It
+// must be called with patternsGuard held.
+func (g *Grok) expandTree(name, expression string, counter *int) (string, []*treeNode, error) {
+	ti := semanticTypes{}
+	names := captureNames{}
+	var result strings.Builder
+	var nodes []*treeNode
+	lastEnd := 0
+	for _, match := range normal.FindAllStringSubmatchIndex(expression, -1) {
+		ref, err := parseReference(expression[match[2]:match[3]])
+		if err != nil {
+			return "", nil, err
+		}
+		// reports unknown patterns and invalid macro calls
+		if _, err := g.callPattern(ref.syntax, g.patterns); err != nil {
+			return "", nil, err
+		}
+
+		text, err := g.translateOniguruma(name, expression[lastEnd:match[0]], lastEnd, ti, names)
+		if err != nil {
+			return "", nil, err
+		}
+		result.WriteString(text)
+
+		node := &treeNode{name: ref.semantic, pattern: ref.syntax, group: fmt.Sprintf("n%d", *counter)}
+		*counter++
+		callee, _, _ := parseCall(ref.syntax)
+		inner, children, err := g.expandTree(callee, g.rawExpression(ref.syntax), counter)
+		if err != nil {
+			return "", nil, err
+		}
+		node.children = children
+		result.WriteString("(?P<" + node.group + ">" + inner + ")")
+		nodes = append(nodes, node)
+
+		lastEnd = match[1]
+	}
+
+	text, err := g.translateOniguruma(name, expression[lastEnd:], lastEnd, ti, names)
+	if err != nil {
+		return "", nil, err
+	}
+	result.WriteString(text)
+	return result.String(), nodes, nil
+}
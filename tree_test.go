@@ -0,0 +1,82 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestParseTree(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	text := `127.0.0.1 - - [23/Apr/2014:22:58:32 +0200] "GET /index.php HTTP/1.1" 404 207`
+
+	root, err := g.ParseTree("%{COMMONAPACHELOG}", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Value != text || root.Start != 0 || len(root.Children) != 1 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+
+	log := root.Children[0]
+	if log.Name != "COMMONAPACHELOG" || log.Pattern != "COMMONAPACHELOG" {
+		t.Fatalf("unexpected node %+v", log)
+	}
+	client := log.Children[0]
+	if client.Name != "clientip" || client.Pattern != "IPORHOST" || client.Value != "127.0.0.1" {
+		t.Fatalf("unexpected node %+v", client)
+	}
+	// the alternatives of IPORHOST are kept apart
+	if len(client.Children) != 2 || client.Children[0].Pattern != "IP" || client.Children[1].Pattern != "HOSTNAME" {
+		t.Fatalf("unexpected children %+v", client.Children)
+	}
+	if host := client.Children[1]; host.Start != -1 || host.Value != "" {
+		t.Fatalf("HOSTNAME should not participate, have %+v", host)
+	}
+	if ip := client.Children[0]; ip.Value != "127.0.0.1" || ip.End != 9 {
+		t.Fatalf("unexpected node %+v", ip)
+	}
+
+	timestamp := find(root, "timestamp")
+	if timestamp == nil || text[timestamp.Start:timestamp.End] != "23/Apr/2014:22:58:32 +0200" {
+		t.Fatalf("unexpected node %+v", timestamp)
+	}
+	if monthday := find(timestamp, "MONTHDAY"); monthday == nil || monthday.Value != "23" {
+		t.Fatalf("unexpected node %+v", monthday)
+	}
+}
+
+func TestParseTreeMacro(t *testing.T) {
+	g, _ := New()
+	g.AddPattern("QUOTED(X)", `"%{X}"`)
+
+	root, err := g.ParseTree("%{QUOTED(INT):n}", `"42"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := root.Children[0]
+	if n.Name != "n" || n.Pattern != "QUOTED(INT)" || n.Value != `"42"` {
+		t.Fatalf("unexpected node %+v", n)
+	}
+	if len(n.Children) != 1 || n.Children[0].Pattern != "INT" || n.Children[0].Value != "42" {
+		t.Fatalf("unexpected children %+v", n.Children)
+	}
+
+	if root, err := g.ParseTree("%{INT}", "abc"); root != nil || err != nil {
+		t.Fatalf("no tree expected, have %+v, %v", root, err)
+	}
+	if _, err := g.ParseTree("%{NOPE}", "abc"); err == nil {
+		t.Fatal("unknown patterns should fail")
+	}
+}
+
+// find returns the first node of the tree with the name, depth first.
+func find(n *Node, name string) *Node {
+	if n.Name == name {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := find(child, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
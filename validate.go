@@ -0,0 +1,242 @@
+package grok
+
+import (
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule validates a field of the results of ParseTyped for the texts matching
+// the expression. Enum, Range and Regexp are only checked when the field has
+// a non empty value.
+type Rule struct {
+	Field    string   // semantic name of the field
+	Required bool     // the field must have a non empty value
+	Enum     []string // allowed values
+	Range    *Range   // bounds of numeric values
+	Regexp   string   // expression the value must match
+}
+
+// Range bounds numeric values, inclusively.
+type Range struct {
+	Min, Max float64
+}
+
+// Violation is a value breaking a Rule.
+type Violation struct {
+	Field string
+	Rule  string // required, enum, range or regexp
+	Value string // empty for a missing field
+}
+
+func (v Violation) Error() string {
+	switch v.Rule {
+	case "required":
+		return fmt.Sprintf("%s is required", v.Field)
+	case "range":
+		return fmt.Sprintf("%s: %q is out of range", v.Field, v.Value)
+	case "regexp":
+		return fmt.Sprintf("%s: %q does not match", v.Field, v.Value)
+	}
+	return fmt.Sprintf("%s: %q is not allowed", v.Field, v.Value)
+}
+
+// ValidationError lists every violation of the rules of a parsed text.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Error()
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// rule is a Rule with its expression compiled.
+type rule struct {
+	Rule
+	regexp *regexp.Regexp
+}
+
+func newRule(r Rule) (rule, error) {
+	if r.Field == "" {
+		return rule{}, fmt.Errorf("rule without field")
+	}
+	if !r.Required && r.Enum == nil && r.Range == nil && r.Regexp == "" {
+		return rule{}, fmt.Errorf("rule for %s without constraint", r.Field)
+	}
+	if r.Range != nil && r.Range.Min > r.Range.Max {
+		return rule{}, fmt.Errorf("rule for %s: empty range [%v, %v]", r.Field, r.Range.Min, r.Range.Max)
+	}
+	compiled := rule{Rule: r}
+	if r.Regexp != "" {
+		re, err := regexp.Compile(r.Regexp)
+		if err != nil {
+			return rule{}, fmt.Errorf("rule for %s: %v", r.Field, err)
+		}
+		compiled.regexp = re
+	}
+	return compiled, nil
+}
+
+// newRules compiles the rules of Config.Rules.
+func newRules(m map[string][]Rule) (map[string][]rule, error) {
+	rules := make(map[string][]rule, len(m))
+	for name, rs := range m {
+		for _, r := range rs {
+			compiled, err := newRule(r)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %s: %v", name, err)
+			}
+			rules[name] = append(rules[name], compiled)
+		}
+	}
+	return rules, nil
+}
+
+// parseRule parses the annotation of a pattern file, one of:
+//
+//	@rule FIELD required
+//	@rule FIELD enum VALUE...
+//	@rule FIELD range MIN MAX
+//	@rule FIELD regexp EXPRESSION
+func parseRule(annotation string) (rule, error) {
+	args := strings.Fields(annotation)
+	if len(args) < 3 || args[0] != "@rule" {
+		return rule{}, fmt.Errorf("invalid rule %q", annotation)
+	}
+	r := Rule{Field: args[1]}
+	switch kind := args[2]; kind {
+	case "required":
+		if len(args) != 3 {
+			return rule{}, fmt.Errorf("invalid rule %q", annotation)
+		}
+		r.Required = true
+	case "enum":
+		if len(args) < 4 {
+			return rule{}, fmt.Errorf("invalid rule %q", annotation)
+		}
+		r.Enum = args[3:]
+	case "range":
+		if len(args) != 5 {
+			return rule{}, fmt.Errorf("invalid rule %q", annotation)
+		}
+		min, err := strconv.ParseFloat(args[3], 64)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid rule %q: %v", annotation, err)
+		}
+		max, err := strconv.ParseFloat(args[4], 64)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid rule %q: %v", annotation, err)
+		}
+		r.Range = &Range{Min: min, Max: max}
+	case "regexp":
+		// the expression is the rest of the line, spaces included
+		rest := strings.TrimSpace(annotation)
+		for _, arg := range args[:3] {
+			rest = strings.TrimSpace(rest[len(arg):])
+		}
+		if rest == "" {
+			return rule{}, fmt.Errorf("invalid rule %q", annotation)
+		}
+		r.Regexp = rest
+	default:
+		return rule{}, fmt.Errorf("unknown rule %q", kind)
+	}
+	return newRule(r)
+}
+
+// ruleGroups maps the groups wrapping the references of patterns carrying
+// rules to the pattern names.
+type ruleGroups map[string]string
+
+// group returns the name of the group wrapping the references of the named
+// pattern and records it.
+func (r ruleGroups) group(pattern string) string {
+	group := fmt.Sprintf("r%x", md5.Sum([]byte(pattern)))
+	r[group] = pattern
+	return group
+}
+
+// hasRules reports whether the named pattern carries rules. It must be called
+// with patternsGuard held.
+func (g *Grok) hasRules(pattern string) bool {
+	return len(g.rules[pattern]) > 0 || len(g.configRules[pattern]) > 0
+}
+
+// groupRules returns the rules of the patterns of groups, those of the pattern
+// files first, by group name. It must be called with patternsGuard held.
+func (g *Grok) groupRules(groups ruleGroups) map[string][]rule {
+	if len(groups) == 0 {
+		return nil
+	}
+	rules := make(map[string][]rule, len(groups))
+	for group, pattern := range groups {
+		rules[group] = append(append([]rule(nil), g.rules[pattern]...), g.configRules[pattern]...)
+	}
+	return rules
+}
+
+// validate checks the captured fields against rules, it returns a
+// *ValidationError listing the violations.
+func (g *Grok) validate(captured []capture, rules []rule) error {
+	values := map[string][]string{}
+	for _, f := range fields(captured) {
+		if g.config.DuplicateFields == DuplicateFieldsCollect && len(f.values) > 1 {
+			values[f.name] = nonEmpty(f.values)
+		} else if v, err := g.value(f); err == nil && v != "" {
+			values[f.name] = []string{v}
+		}
+	}
+
+	var violations []Violation
+	for _, r := range rules {
+		name := r.Field
+		if path := g.fieldPath(name); len(path) > 0 && g.config.FlattenNested {
+			name = strings.Join(path, ".")
+		}
+		if len(values[name]) == 0 {
+			if r.Required {
+				violations = append(violations, Violation{Field: r.Field, Rule: "required"})
+			}
+			continue
+		}
+		for _, v := range values[name] {
+			if kind := r.check(v); kind != "" {
+				violations = append(violations, Violation{Field: r.Field, Rule: kind, Value: v})
+			}
+		}
+	}
+	if violations != nil {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// check returns the kind of the constraint the non empty value breaks, empty
+// when it is valid.
+func (r rule) check(value string) string {
+	if r.Enum != nil {
+		allowed := false
+		for _, e := range r.Enum {
+			allowed = allowed || e == value
+		}
+		if !allowed {
+			return "enum"
+		}
+	}
+	if r.Range != nil {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n < r.Range.Min || n > r.Range.Max {
+			return "range"
+		}
+	}
+	if r.regexp != nil && !r.regexp.MatchString(value) {
+		return "regexp"
+	}
+	return ""
+}
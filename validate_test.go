@@ -0,0 +1,192 @@
+package grok
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidationRules(t *testing.T) {
+	g, err := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		Patterns:          map[string]string{"ACCESS": `%{IP:clientip}? %{WORD:verb} %{NOTSPACE:path} %{INT:response:int}`},
+		Rules: map[string][]Rule{
+			"ACCESS": {
+				{Field: "clientip", Required: true},
+				{Field: "verb", Enum: []string{"GET", "POST"}},
+				{Field: "response", Range: &Range{Min: 100, Max: 599}},
+				{Field: "path", Regexp: `^/`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := g.ParseTyped("%{ACCESS}", "127.0.0.1 GET /index.html 200")
+	if err != nil || values["response"] != 200 {
+		t.Fatalf("unexpected result %v, %v", values, err)
+	}
+
+	// every violation is reported, along with the captures
+	values, err = g.ParseTyped("%{ACCESS}", " PUT index.html 700")
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("a validation error should be returned, have %v", err)
+	}
+	expected := []Violation{
+		{Field: "clientip", Rule: "required"},
+		{Field: "verb", Rule: "enum", Value: "PUT"},
+		{Field: "response", Rule: "range", Value: "700"},
+		{Field: "path", Rule: "regexp", Value: "index.html"},
+	}
+	if !reflect.DeepEqual(validation.Violations, expected) {
+		t.Fatalf("expected %v, have %v", expected, validation.Violations)
+	}
+	if values["verb"] != "PUT" {
+		t.Fatalf("the captures should be returned, have %v", values)
+	}
+
+	// rules apply to the expressions referencing the pattern, Parse is not
+	// affected
+	if _, err := g.ParseTyped("<%{ACCESS}>", "<127.0.0.1 PUT / 200>"); err == nil {
+		t.Fatal("the rules of referenced patterns should apply")
+	}
+	if _, err := g.Parse("%{ACCESS}", "127.0.0.1 PUT / 200"); err != nil {
+		t.Fatal(err)
+	}
+
+	// texts that do not match are not validated, the required clientip is
+	// not reported
+	if values, err := g.ParseTyped("%{ACCESS}", "nothing"); err != nil || len(values) != 0 {
+		t.Fatalf("unexpected result %v, %v", values, err)
+	}
+	compiled, _ := g.Compile("%{ACCESS}")
+	if values, err := compiled.ParseTyped("nothing"); err != nil || len(values) != 0 {
+		t.Fatalf("unexpected result %v, %v", values, err)
+	}
+	if _, err := g.ParseTyped("%{WORD:verb}", "PUT"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidationRulesAlternation(t *testing.T) {
+	g, _ := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		Patterns:          map[string]string{"A": `a=%{INT:a}`, "B": `b=(?:%{INT:b})?`, "AB": `%{A}|%{B}`},
+		Rules: map[string][]Rule{
+			"B":                {{Field: "b", Required: true}},
+			"HTTPD24_ERRORLOG": {{Field: "pid", Required: true}},
+		},
+	})
+
+	// the rules of a pattern apply when its reference takes part in the match
+	for _, pattern := range []string{"%{AB}", "(?:%{A}|%{B})", "%{A}(?: %{B})?"} {
+		values, err := g.ParseTyped(pattern, "a=1")
+		if err != nil || values["a"] != "1" {
+			t.Fatalf("%s: unexpected result %v, %v", pattern, values, err)
+		}
+	}
+	if _, err := g.ParseTyped("%{AB}", "b="); err == nil {
+		t.Fatal("a validation error should be returned")
+	}
+	values, err := g.ParseTyped("%{HTTPD_ERRORLOG}", `[Mon Aug 31 09:30:48 2015] [error] [client 10.0.0.1] File does not exist: /var/www/favicon.ico`)
+	if err != nil || values["clientip"] != "10.0.0.1" {
+		t.Fatalf("unexpected result %v, %v", values, err)
+	}
+
+	// a pattern referenced more than once is validated once
+	g, _ = NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		Patterns:          map[string]string{"B": `b=%{WORD:b}`},
+		Rules:             map[string][]Rule{"B": {{Field: "b", Enum: []string{"x"}}}},
+	})
+	_, err = g.ParseTyped("%{B} %{B}", "b=y b=z")
+	var validation *ValidationError
+	if !errors.As(err, &validation) || len(validation.Violations) != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestValidationRulesCollectedValues(t *testing.T) {
+	g, _ := NewWithConfig(&Config{
+		NamedCapturesOnly: true,
+		DuplicateFields:   DuplicateFieldsCollect,
+		Patterns:          map[string]string{"PAIR": `%{INT:n} %{INT:n}`},
+		Rules:             map[string][]Rule{"PAIR": {{Field: "n", Range: &Range{Min: 0, Max: 10}}}},
+	})
+	_, err := g.ParseTyped("%{PAIR}", "5 12")
+	var validation *ValidationError
+	if !errors.As(err, &validation) || len(validation.Violations) != 1 || validation.Violations[0].Value != "12" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestValidationRulesAnnotations(t *testing.T) {
+	g, _ := NewWithConfig(&Config{NamedCapturesOnly: true})
+	err := g.AddPatternsFromReader(strings.NewReader(`# a request
+# @rule verb enum GET POST
+# @rule path regexp ^/[a-z ]*$
+# @rule [http][status] range 100 599
+
+REQUEST %{WORD:verb} %{DATA:path} %{INT:[http][status]}
+OTHER %{WORD:verb}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.ParseTyped("%{REQUEST}$", "PUT /a b 99")
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("a validation error should be returned, have %v", err)
+	}
+	if err.Error() != `validation failed: verb: "PUT" is not allowed; [http][status]: "99" is out of range` {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := g.ParseTyped("%{OTHER}", "PUT"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rules are kept across reloads
+	if err := g.ReloadPatterns(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.ParseTyped("%{REQUEST}$", "PUT /a 200"); err == nil {
+		t.Fatal("the rules should be kept")
+	}
+
+	// redefining the pattern drops its rules
+	if err := g.AddPattern("REQUEST", "%{WORD:verb}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.ParseTyped("%{REQUEST}", "PUT"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidationRulesErrors(t *testing.T) {
+	for _, file := range []string{
+		"# @rule verb\nA .",
+		"# @rule verb unknown\nA .",
+		"# @rule n range 1\nA .",
+		"# @rule n range 2 1\nA .",
+		"# @rule p regexp (\nA .",
+		"A .\n# @rule verb required\n",
+	} {
+		if _, err := readPatterns(strings.NewReader(file), "test"); err == nil {
+			t.Fatalf("%q should be rejected", file)
+		}
+	}
+
+	for _, rules := range []map[string][]Rule{
+		{"A": {{Required: true}}},
+		{"A": {{Field: "verb"}}},
+		{"A": {{Field: "verb", Regexp: "("}}},
+	} {
+		if _, err := NewWithConfig(&Config{Rules: rules}); err == nil {
+			t.Fatalf("%v should be rejected", rules)
+		}
+	}
+}
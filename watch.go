@@ -0,0 +1,228 @@
+package grok
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watcher polls the pattern files of Config.PatternsDir, see
+// WatchPatternsDir.
+type Watcher struct {
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Stop stops the watcher, waiting for a reload in progress to complete. It may
+// be called more than once.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// fileStamp is the digest of the content of a pattern file.
+type fileStamp [sha256.Size]byte
+
+// WatchPatternsDir polls the files of Config.PatternsDir every interval and
+// calls ReloadPatterns when one of them is created, modified or removed. Files
+// are compared on their content, so rewrites keeping the size and the
+// modification time of a file are noticed as well.
+// Errors are reported to onError, which may be nil, while the Grok object
+// keeps using its last good set of patterns, see ReloadPatterns.
+func (g *Grok) WatchPatternsDir(interval time.Duration, onError func(error)) *Watcher {
+	w := &Watcher{stop: make(chan struct{}), done: make(chan struct{})}
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+
+	stamps, err := g.patternsDirStamps()
+	if err != nil {
+		report(err)
+	}
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+
+			current, err := g.patternsDirStamps()
+			if err != nil {
+				report(err)
+				continue
+			}
+			if sameStamps(stamps, current) {
+				continue
+			}
+			stamps = current
+			if err := g.ReloadPatterns(); err != nil {
+				report(err)
+			}
+		}
+	}()
+
+	return w
+}
+
+// StaleExpressionsError lists the cached expressions evicted by
+// ReloadPatterns because they no longer compile with the reloaded patterns,
+// which are in use nonetheless.
+type StaleExpressionsError struct {
+	Expressions map[string]error
+}
+
+func (e *StaleExpressionsError) Error() string {
+	expressions := make([]string, 0, len(e.Expressions))
+	for expression := range e.Expressions {
+		expressions = append(expressions, expression)
+	}
+	sort.Strings(expressions)
+	messages := make([]string, len(expressions))
+	for i, expression := range expressions {
+		messages[i] = fmt.Sprintf("%q: %v", expression, e.Expressions[expression])
+	}
+	return "evicted cached expressions: " + strings.Join(messages, "; ")
+}
+
+// ReloadPatterns loads again the patterns designated by the configuration,
+// along with the patterns added since the Grok object was created. The new
+// patterns are swapped in atomically, along with the cached expressions
+// compiled again with them, only if every one of them compiles. On error the
+// current patterns are kept. Cached expressions that no longer compile are
+// evicted and reported by a *StaleExpressionsError, the new patterns being in
+// use.
+func (g *Grok) ReloadPatterns() error {
+	g.patternsGuard.Lock()
+	defer g.patternsGuard.Unlock()
+
+	fresh := newGrok(g.config)
+	fresh.modifiers = g.modifiers
+	if err := fresh.loadConfig(); err != nil {
+		return err
+	}
+	if err := fresh.addRawPatterns(g.addedPatterns, g.addedSources, g.addedRules); err != nil {
+		return err
+	}
+	fresh.configured = true
+	for name, pattern := range g.addedPatterns {
+		fresh.addedPatterns[name] = pattern
+	}
+	for name, source := range g.addedSources {
+		fresh.addedSources[name] = source
+	}
+	for name, rules := range g.addedRules {
+		fresh.addedRules[name] = rules
+	}
+
+	// patterns out of reach of the engine only fail when used, see CompatError
+	names := make([]string, 0, len(fresh.patterns))
+	for name, p := range fresh.patterns {
+		if p.macro == nil && p.err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fresh.engine().Compile(fresh.patterns[name].expression); err != nil {
+			return fresh.located(name, fmt.Errorf("cannot compile pattern %q: %v", name, err))
+		}
+	}
+
+	// compile the cached expressions again, least recently used first so the
+	// new cache keeps the same eviction order
+	g.compiledGuard.RLock()
+	var cached []string
+	for e := g.compiledPatterns.ll.Back(); e != nil; e = e.Prev() {
+		cached = append(cached, e.Value.(*cacheEntry).key)
+	}
+	g.compiledGuard.RUnlock()
+	var stale *StaleExpressionsError
+	for _, key := range cached {
+		key, fields := splitFieldsKey(key)
+		pattern, defs := splitCacheKey(key)
+		// expressions referring to removed patterns must not block the
+		// reload
+		if _, err := fresh.compileFields(pattern, defs, fields); err != nil {
+			if stale == nil {
+				stale = &StaleExpressionsError{Expressions: map[string]error{}}
+			}
+			stale.Expressions[pattern] = err
+		}
+	}
+
+	g.compiledGuard.Lock()
+	g.rawPattern = fresh.rawPattern
+	g.patterns = fresh.patterns
+	g.sources = fresh.sources
+	g.dependencies = fresh.dependencies
+	g.fieldTypes = fresh.fieldTypes
+	g.addedPatterns = fresh.addedPatterns
+	g.addedSources = fresh.addedSources
+	g.rules = fresh.rules
+	g.addedRules = fresh.addedRules
+	g.configRules = fresh.configRules
+
+	old := g.compiledPatterns
+	fresh.compiledPatterns.hits, fresh.compiledPatterns.misses = old.hits, old.misses
+	fresh.compiledPatterns.evictions = old.evictions
+	g.compiledPatterns = fresh.compiledPatterns
+	g.generation++
+	g.compiledGuard.Unlock()
+
+	if stale != nil {
+		return stale
+	}
+	return nil
+}
+
+// patternsDirStamps returns the digest of every file designated by
+// Config.PatternsDir.
+func (g *Grok) patternsDirStamps() (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+	for _, path := range g.config.PatternsDir {
+		base, pattern, _, err := resolvePatternsPath(path)
+		if err != nil {
+			return nil, err
+		}
+		fsys := os.DirFS(base)
+		files, err := globFS(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range files {
+			content, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			stamps[filepath.Join(base, filepath.FromSlash(name))] = sha256.Sum256(content)
+		}
+	}
+	return stamps, nil
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, stamp := range a {
+		if other, ok := b[name]; !ok || other != stamp {
+			return false
+		}
+	}
+	return true
+}
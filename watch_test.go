@@ -0,0 +1,137 @@
+package grok
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom", "CODE \\d{3}\n")
+
+	g, err := NewWithConfig(&Config{PatternsDir: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.AddPattern("STATUS", "%{CODE:code}")
+	if captures, _ := g.Parse("%{STATUS}", "404"); captures["code"] != "404" {
+		t.Fatalf("code should be '404' have '%s'", captures["code"])
+	}
+
+	writePatternFile(t, dir, "custom", "CODE [A-Z]{3}\n")
+	if err := g.ReloadPatterns(); err != nil {
+		t.Fatal(err)
+	}
+	if captures, _ := g.Parse("%{STATUS}", "404 ERR"); captures["code"] != "ERR" {
+		t.Fatalf("code should be 'ERR' have '%s'", captures["code"])
+	}
+
+	// a broken set of patterns is rejected as a whole
+	writePatternFile(t, dir, "custom", "CODE %{MISSING}\n")
+	if err := g.ReloadPatterns(); err == nil {
+		t.Fatal("ReloadPatterns should return an error")
+	}
+	if captures, _ := g.Parse("%{STATUS}", "404 ERR"); captures["code"] != "ERR" {
+		t.Fatalf("last good patterns should be kept, code should be 'ERR' have '%s'", captures["code"])
+	}
+}
+
+func TestReloadPatternsRejectsInvalidExpressions(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom", "CODE \\d{3}\n")
+
+	g, _ := NewWithConfig(&Config{PatternsDir: []string{dir}})
+	writePatternFile(t, dir, "custom", "CODE [0-\n")
+	if err := g.ReloadPatterns(); err == nil || !strings.Contains(err.Error(), "CODE") {
+		t.Fatalf("ReloadPatterns should fail on the invalid pattern, have %v", err)
+	}
+	if captures, err := g.Parse("%{CODE:code}", "404"); err != nil || captures["code"] != "404" {
+		t.Fatalf("last good patterns should be kept, have %v, %v", captures, err)
+	}
+}
+
+func TestReloadPatternsEvictsBrokenCachedExpressions(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom", "CODE \\d{3}\nOTHER \\w+\n")
+
+	g, _ := NewWithConfig(&Config{PatternsDir: []string{dir}})
+	g.Parse("%{CODE:code}", "404")
+	g.Parse("%{OTHER:other}", "x")
+
+	// the cached expression referring to the removed pattern does not block
+	// the reload, it is reported
+	writePatternFile(t, dir, "custom", "OTHER \\d+\n")
+	var stale *StaleExpressionsError
+	if err := g.ReloadPatterns(); !errors.As(err, &stale) || len(stale.Expressions) != 1 || stale.Expressions["%{CODE:code}"] == nil {
+		t.Fatalf("the evicted expression should be reported, have %v", err)
+	}
+	if size := g.CacheStats().Size; size != 1 {
+		t.Fatalf("the broken expression should be evicted, have %d cached expressions", size)
+	}
+	if _, err := g.Parse("%{CODE:code}", "404"); err == nil {
+		t.Fatal("the removed pattern should be reported")
+	}
+	if captures, _ := g.Parse("%{OTHER:other}", "x 42"); captures["other"] != "42" {
+		t.Fatalf("other should be '42' have '%s'", captures["other"])
+	}
+
+	writePatternFile(t, dir, "custom", "OTHER [a-z]+\n")
+	if err := g.ReloadPatterns(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchPatternsDir(t *testing.T) {
+	dir := t.TempDir()
+	writePatternFile(t, dir, "custom", "CODE \\d{3}\n")
+
+	g, _ := NewWithConfig(&Config{PatternsDir: []string{dir}})
+
+	var mu sync.Mutex
+	var errs []error
+	w := g.WatchPatternsDir(10*time.Millisecond, func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	defer w.Stop()
+
+	writePatternFile(t, dir, "custom", "CODE %{MISSING}\n")
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) > 0
+	})
+	if captures, _ := g.Parse("%{CODE:code}", "404"); captures["code"] != "404" {
+		t.Fatalf("last good patterns should be kept, code should be '404' have '%s'", captures["code"])
+	}
+
+	writePatternFile(t, dir, "custom", "CODE [A-Z]{3,}\n")
+	waitFor(t, func() bool {
+		captures, _ := g.Parse("%{CODE:code}", "404 ERR")
+		return captures["code"] == "ERR"
+	})
+
+	// a rewrite of the same size within the modification time granularity
+	writePatternFile(t, dir, "custom", "CODE [a-z]{3,}\n")
+	waitFor(t, func() bool {
+		captures, _ := g.Parse("%{CODE:code}", "404 err")
+		return captures["code"] == "err"
+	})
+
+	w.Stop()
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}